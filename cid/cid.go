@@ -0,0 +1,180 @@
+// Package cid computes IPFS content identifiers (CIDs) locally so uploads to Apillon storage
+// can be verified. It builds UnixFS DAGs with the same chunking and layout defaults as
+// `ipfs add` and encodes the resulting CIDs in version 0 or version 1 form.
+package cid
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Multicodec codes used by UnixFS DAGs.
+const (
+	CodecRaw    uint64 = 0x55 // Raw leaf blocks
+	CodecDagPB  uint64 = 0x70 // dag-pb (protobuf) nodes
+	hashSHA2256 uint64 = 0x12 // sha2-256 multihash code
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Cid is a content identifier.
+type Cid struct {
+	Version int    // CID version, 0 or 1
+	Codec   uint64 // Multicodec of the referenced block
+	Hash    []byte // Multihash of the referenced block
+}
+
+// Bytes returns the binary representation of the CID.
+func (c Cid) Bytes() []byte {
+	if c.Version == 0 {
+		return append([]byte(nil), c.Hash...)
+	}
+	buf := binary.AppendUvarint(nil, uint64(c.Version))
+	buf = binary.AppendUvarint(buf, c.Codec)
+	return append(buf, c.Hash...)
+}
+
+// String returns the canonical text form of the CID: base58btc for version 0
+// and base32 lower-case multibase for version 1.
+func (c Cid) String() string {
+	if c.Version == 0 {
+		return encodeBase58(c.Hash)
+	}
+	return "b" + base32Lower.EncodeToString(c.Bytes())
+}
+
+// Equals reports whether both CIDs have the same version, codec and multihash.
+func (c Cid) Equals(other Cid) bool {
+	return c.Version == other.Version && c.Codec == other.Codec && bytes.Equal(c.Hash, other.Hash)
+}
+
+// SameBlock reports whether both CIDs reference the same block, regardless of CID version.
+func (c Cid) SameBlock(other Cid) bool {
+	return c.Codec == other.Codec && bytes.Equal(c.Hash, other.Hash)
+}
+
+// ToV1 returns the version 1 form of the CID.
+func (c Cid) ToV1() Cid {
+	return Cid{Version: 1, Codec: c.Codec, Hash: c.Hash}
+}
+
+// ToV0 returns the version 0 form of the CID.
+// Only dag-pb CIDs using sha2-256 can be expressed as version 0.
+func (c Cid) ToV0() (Cid, error) {
+	if c.Codec != CodecDagPB {
+		return Cid{}, fmt.Errorf("cid %s uses codec 0x%x, version 0 requires dag-pb", c, c.Codec)
+	}
+	if len(c.Hash) != 34 || c.Hash[0] != byte(hashSHA2256) || c.Hash[1] != 32 {
+		return Cid{}, fmt.Errorf("cid %s does not use a sha2-256 multihash, required for version 0", c)
+	}
+	return Cid{Version: 0, Codec: CodecDagPB, Hash: c.Hash}, nil
+}
+
+// Parse decodes a CID from its text form. Version 0 CIDs (base58btc "Qm...") and version 1
+// CIDs in base32 ("b...", "B...") or base58btc ("z...") multibase are supported.
+func Parse(s string) (Cid, error) {
+	if len(s) == 46 && strings.HasPrefix(s, "Qm") {
+		hash, err := decodeBase58(s)
+		if err != nil {
+			return Cid{}, fmt.Errorf("invalid cid %q: %w", s, err)
+		}
+		if len(hash) != 34 || hash[0] != byte(hashSHA2256) || hash[1] != 32 {
+			return Cid{}, fmt.Errorf("invalid cid %q: not a sha2-256 multihash", s)
+		}
+		return Cid{Version: 0, Codec: CodecDagPB, Hash: hash}, nil
+	}
+	if len(s) < 2 {
+		return Cid{}, fmt.Errorf("invalid cid %q: too short", s)
+	}
+
+	var data []byte
+	var err error
+	switch s[0] {
+	case 'b':
+		data, err = base32Lower.DecodeString(s[1:])
+	case 'B':
+		data, err = base32Lower.DecodeString(strings.ToLower(s[1:]))
+	case 'z':
+		data, err = decodeBase58(s[1:])
+	default:
+		return Cid{}, fmt.Errorf("invalid cid %q: unsupported multibase prefix %q", s, s[0])
+	}
+	if err != nil {
+		return Cid{}, fmt.Errorf("invalid cid %q: %w", s, err)
+	}
+	return decodeBinary(s, data)
+}
+
+// decodeBinary decodes a binary version 1 CID.
+func decodeBinary(s string, data []byte) (Cid, error) {
+	version, n := binary.Uvarint(data)
+	if n <= 0 || version != 1 {
+		return Cid{}, fmt.Errorf("invalid cid %q: unsupported version", s)
+	}
+	data = data[n:]
+
+	codec, n := binary.Uvarint(data)
+	if n <= 0 {
+		return Cid{}, fmt.Errorf("invalid cid %q: malformed codec", s)
+	}
+	data = data[n:]
+
+	if _, n = binary.Uvarint(data); n <= 0 {
+		return Cid{}, fmt.Errorf("invalid cid %q: malformed multihash code", s)
+	}
+	length, m := binary.Uvarint(data[n:])
+	if m <= 0 || uint64(len(data)-n-m) != length {
+		return Cid{}, fmt.Errorf("invalid cid %q: malformed multihash length", s)
+	}
+	return Cid{Version: 1, Codec: codec, Hash: append([]byte(nil), data...)}, nil
+}
+
+// encodeBase58 encodes data with the base58btc alphabet.
+func encodeBase58(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// decodeBase58 decodes a base58btc string.
+func decodeBase58(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		idx := strings.IndexRune(base58Alphabet, r)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+
+	out := n.Bytes()
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), out...), nil
+}
@@ -0,0 +1,154 @@
+package cid
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opts    Options
+		want    string
+	}{
+		{"EmptyV0", "", V0(), "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"},
+		{"EmptyV1", "", V1(), "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},
+		{"HelloWorldV0", "hello world", V0(), "Qmf412jQZiuVUtdgnB36FXFX7xg5V6KEbSJ4dpQuhkLyfD"},
+		{"HelloWorldNewlineV0", "hello world\n", V0(), "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"},
+		{"HelloWorldV1", "hello world", V1(), "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromBytes([]byte(tt.content), tt.opts)
+			if err != nil {
+				t.Fatalf("FromBytes returned error: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("FromBytes(%q) = %s, want %s", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromBytes_Chunked(t *testing.T) {
+	content := make([]byte, 10)
+	single, err := FromBytes(content, Options{ChunkSize: 16})
+	if err != nil {
+		t.Fatalf("FromBytes returned error: %v", err)
+	}
+	chunked, err := FromBytes(content, Options{ChunkSize: 4})
+	if err != nil {
+		t.Fatalf("FromBytes returned error: %v", err)
+	}
+	if single.Equals(chunked) {
+		t.Errorf("chunked and single-block DAGs should differ, both are %s", single)
+	}
+
+	// A multi-chunk file is rooted in a dag-pb node even with raw leaves
+	rawChunked, err := FromBytes(content, Options{Version: 1, RawLeaves: true, ChunkSize: 4})
+	if err != nil {
+		t.Fatalf("FromBytes returned error: %v", err)
+	}
+	if rawChunked.Codec != CodecDagPB {
+		t.Errorf("expected dag-pb root for chunked raw-leaf file, got codec 0x%x", rawChunked.Codec)
+	}
+}
+
+func TestFromDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	empty, err := FromDirectory(dir, V0())
+	if err != nil {
+		t.Fatalf("FromDirectory returned error: %v", err)
+	}
+	if empty.String() != "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn" {
+		t.Errorf("unexpected CID for empty directory: %s", empty)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	first, err := FromDirectory(dir, V0())
+	if err != nil {
+		t.Fatalf("FromDirectory returned error: %v", err)
+	}
+	if first.Equals(empty) {
+		t.Error("directory CID did not change after adding files")
+	}
+	again, err := FromDirectory(dir, V0())
+	if err != nil {
+		t.Fatalf("FromDirectory returned error: %v", err)
+	}
+	if !first.Equals(again) {
+		t.Errorf("directory CID is not deterministic: %s != %s", first, again)
+	}
+}
+
+// TestFromDirectory_Vector checks a nested directory against the CIDs printed by
+// `ipfs add -r` (kubo v0.29.0) with and without --cid-version=1.
+func TestFromDirectory_Vector(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a", "hello.txt": "hello world\n", "sub/b.txt": "b"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"V0", V0(), "QmV91fXKx9xpdAJH4g7ZgJbqKnMyDs4eGzCKfSA7oQ7jim"},
+		{"V1", V1(), "bafybeiepguqxsbje64jysrlfv5bqi2aou4ocyfygrha332l35i6j33cs6q"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromDirectory(dir, tt.opts)
+			if err != nil {
+				t.Fatalf("FromDirectory returned error: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("FromDirectory = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	v0, err := Parse("QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	v1 := v0.ToV1()
+	if v1.String() != "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354" {
+		t.Errorf("unexpected v1 form: %s", v1)
+	}
+
+	parsed, err := Parse(v1.String())
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if !parsed.Equals(v1) || !parsed.SameBlock(v0) {
+		t.Errorf("round trip mismatch: %+v", parsed)
+	}
+
+	back, err := parsed.ToV0()
+	if err != nil || back.String() != v0.String() {
+		t.Errorf("ToV0() = %s, %v", back, err)
+	}
+
+	if _, err := Parse("not-a-cid"); err == nil {
+		t.Error("expected error for invalid CID")
+	}
+}
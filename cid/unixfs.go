@@ -0,0 +1,290 @@
+package cid
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Defaults used by `ipfs add`.
+const (
+	DefaultChunkSize    = 256 * 1024 // Size of each file chunk in bytes
+	DefaultLinksPerNode = 174        // Maximum number of links per node in the balanced layout
+)
+
+// UnixFS data types.
+const (
+	unixfsDirectory = 1
+	unixfsFile      = 2
+	unixfsSymlink   = 4
+)
+
+// Options controls how DAGs are built.
+type Options struct {
+	// Version is the CID version of the produced CIDs, 0 or 1.
+	Version int
+	// RawLeaves stores file chunks as raw blocks instead of UnixFS nodes.
+	// Only valid with version 1. V1 enables it by default, matching `ipfs add --cid-version=1`.
+	RawLeaves bool
+	// ChunkSize is the size of each file chunk. Defaults to DefaultChunkSize.
+	ChunkSize int
+}
+
+// V0 returns the options used by `ipfs add` without flags.
+func V0() Options {
+	return Options{Version: 0}
+}
+
+// V1 returns the options used by `ipfs add --cid-version=1`.
+func V1() Options {
+	return Options{Version: 1, RawLeaves: true}
+}
+
+func (o Options) validate() (Options, error) {
+	if o.Version != 0 && o.Version != 1 {
+		return o, fmt.Errorf("unsupported cid version %d", o.Version)
+	}
+	if o.Version == 0 && o.RawLeaves {
+		return o, fmt.Errorf("raw leaves require cid version 1")
+	}
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = DefaultChunkSize
+	}
+	return o, nil
+}
+
+// node is a block of the DAG referenced by its parent.
+type node struct {
+	cid      Cid
+	tsize    uint64 // Size of the block plus the sizes of all blocks below it
+	fileSize uint64 // Size of the file data below the node
+}
+
+// FromBytes computes the CID of a file with the given content.
+func FromBytes(data []byte, opts Options) (Cid, error) {
+	return FromReader(bytes.NewReader(data), opts)
+}
+
+// FromFile computes the CID of the file at path.
+func FromFile(path string, opts Options) (Cid, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Cid{}, err
+	}
+	defer f.Close()
+	return FromReader(f, opts)
+}
+
+// FromReader computes the CID of a file by reading its content from r.
+// The content is split into fixed-size chunks and arranged in a balanced DAG.
+func FromReader(r io.Reader, opts Options) (Cid, error) {
+	opts, err := opts.validate()
+	if err != nil {
+		return Cid{}, err
+	}
+	n, err := fileNode(r, opts)
+	if err != nil {
+		return Cid{}, err
+	}
+	return n.cid, nil
+}
+
+// FromDirectory computes the CID of the directory at path, like `ipfs add -r --hidden`.
+// Symbolic links are added as UnixFS symlinks and are not followed. Directories large
+// enough to require HAMT sharding are not supported and produce a different CID.
+func FromDirectory(path string, opts Options) (Cid, error) {
+	opts, err := opts.validate()
+	if err != nil {
+		return Cid{}, err
+	}
+	n, err := directoryNode(path, opts)
+	if err != nil {
+		return Cid{}, err
+	}
+	return n.cid, nil
+}
+
+// fileNode builds the DAG for a file and returns its root.
+func fileNode(r io.Reader, opts Options) (node, error) {
+	var leaves []node
+	buf := make([]byte, opts.ChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			leaves = append(leaves, leafNode(buf[:n], opts))
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return node{}, err
+		}
+	}
+
+	if len(leaves) == 0 {
+		return leafNode(nil, opts), nil
+	}
+
+	// Group nodes into parents layer by layer, which yields the same tree as the balanced builder
+	for len(leaves) > 1 {
+		var parents []node
+		for start := 0; start < len(leaves); start += DefaultLinksPerNode {
+			end := min(start+DefaultLinksPerNode, len(leaves))
+			parents = append(parents, fileParentNode(leaves[start:end], opts))
+		}
+		leaves = parents
+	}
+	return leaves[0], nil
+}
+
+// leafNode builds a block holding a single chunk of file data.
+func leafNode(chunk []byte, opts Options) node {
+	if opts.RawLeaves {
+		return node{
+			cid:      newCid(1, CodecRaw, chunk),
+			tsize:    uint64(len(chunk)),
+			fileSize: uint64(len(chunk)),
+		}
+	}
+
+	data := unixfsData(unixfsFile, chunk, uint64(len(chunk)), nil)
+	block := encodePBNode(nil, data)
+	return node{
+		cid:      newCid(opts.Version, CodecDagPB, block),
+		tsize:    uint64(len(block)),
+		fileSize: uint64(len(chunk)),
+	}
+}
+
+// fileParentNode builds an intermediate file node linking to children.
+func fileParentNode(children []node, opts Options) node {
+	links := make([]pbLink, len(children))
+	blockSizes := make([]uint64, len(children))
+	var fileSize, tsize uint64
+	for i, child := range children {
+		links[i] = pbLink{hash: child.cid.Bytes(), tsize: child.tsize}
+		blockSizes[i] = child.fileSize
+		fileSize += child.fileSize
+		tsize += child.tsize
+	}
+
+	block := encodePBNode(links, unixfsData(unixfsFile, nil, fileSize, blockSizes))
+	return node{
+		cid:      newCid(opts.Version, CodecDagPB, block),
+		tsize:    tsize + uint64(len(block)),
+		fileSize: fileSize,
+	}
+}
+
+// directoryNode builds the DAG for a directory and all of its entries.
+func directoryNode(path string, opts Options) (node, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return node{}, err
+	}
+
+	links := make([]pbLink, 0, len(entries))
+	var tsize uint64
+	for _, entry := range entries {
+		child, err := entryNode(filepath.Join(path, entry.Name()), entry, opts)
+		if err != nil {
+			return node{}, err
+		}
+		links = append(links, pbLink{name: entry.Name(), hash: child.cid.Bytes(), tsize: child.tsize})
+		tsize += child.tsize
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].name < links[j].name })
+
+	block := encodePBNode(links, unixfsData(unixfsDirectory, nil, 0, nil))
+	return node{
+		cid:   newCid(opts.Version, CodecDagPB, block),
+		tsize: tsize + uint64(len(block)),
+	}, nil
+}
+
+// entryNode builds the DAG for a single directory entry.
+func entryNode(path string, entry os.DirEntry, opts Options) (node, error) {
+	switch {
+	case entry.Type()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return node{}, err
+		}
+		block := encodePBNode(nil, unixfsData(unixfsSymlink, []byte(target), 0, nil))
+		return node{cid: newCid(opts.Version, CodecDagPB, block), tsize: uint64(len(block))}, nil
+	case entry.IsDir():
+		return directoryNode(path, opts)
+	case entry.Type().IsRegular():
+		f, err := os.Open(path)
+		if err != nil {
+			return node{}, err
+		}
+		defer f.Close()
+		return fileNode(f, opts)
+	default:
+		return node{}, fmt.Errorf("unsupported file type %s for %s", entry.Type(), path)
+	}
+}
+
+// newCid hashes block with sha2-256 and returns its CID.
+func newCid(version int, codec uint64, block []byte) Cid {
+	sum := sha256.Sum256(block)
+	hash := append([]byte{byte(hashSHA2256), byte(len(sum))}, sum[:]...)
+	return Cid{Version: version, Codec: codec, Hash: hash}
+}
+
+// pbLink is a link of a dag-pb node.
+type pbLink struct {
+	hash  []byte
+	name  string
+	tsize uint64
+}
+
+// encodePBNode encodes a dag-pb node in canonical form: links first, then data.
+func encodePBNode(links []pbLink, data []byte) []byte {
+	var buf []byte
+	for _, l := range links {
+		var lb []byte
+		lb = appendBytesField(lb, 1, l.hash)
+		// go-ipfs always writes the link name, even when it is empty
+		lb = appendBytesField(lb, 2, []byte(l.name))
+		lb = appendVarintField(lb, 3, l.tsize)
+		buf = appendBytesField(buf, 2, lb)
+	}
+	if data != nil {
+		buf = appendBytesField(buf, 1, data)
+	}
+	return buf
+}
+
+// unixfsData encodes a UnixFS Data message. A nil data slice omits the Data field.
+func unixfsData(typ uint64, data []byte, fileSize uint64, blockSizes []uint64) []byte {
+	buf := appendVarintField(nil, 1, typ)
+	if data != nil {
+		buf = appendBytesField(buf, 2, data)
+	}
+	if typ == unixfsFile {
+		buf = appendVarintField(buf, 3, fileSize)
+		for _, size := range blockSizes {
+			buf = appendVarintField(buf, 4, size)
+		}
+	}
+	return buf
+}
+
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3)
+	return binary.AppendUvarint(buf, v)
+}
+
+func appendBytesField(buf []byte, field int, v []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|2)
+	buf = binary.AppendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
@@ -1,10 +1,11 @@
 // Package requests provides helper functions for making authenticated HTTP requests
-// to the Apillon API. It supports GET, POST, and DELETE methods, and manages API key authentication.
+// to the Apillon API. It supports GET, POST, PATCH, and DELETE methods, and manages API key authentication.
 package requests
 
 import (
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 )
 
@@ -30,7 +31,7 @@ func getAPIKey() string {
 //
 // Parameters:
 //   - path: The API endpoint path (e.g., "/storage/buckets").
-//   - params: Optional query parameters as a map[string]string.
+//   - params: Optional query parameters as a map[string]string. Values are URL-encoded.
 //
 // Returns:
 //   - string: The response body as a string.
@@ -39,11 +40,11 @@ func GetReq(path string, params map[string]string) (string, error) {
 	url := "https://api.apillon.io" + path
 
 	if len(params) > 0 {
-		url += "?"
+		query := neturl.Values{}
 		for key, value := range params {
-			url += key + "=" + value + "&"
+			query.Set(key, value)
 		}
-		url = url[:len(url)-1] // Remove the trailing '&'
+		url += "?" + query.Encode()
 	}
 
 	req, err := http.NewRequest("GET", url, nil)
@@ -109,6 +110,44 @@ func PostReq(path string, body io.Reader) (string, error) {
 	return string(responseBody), nil
 }
 
+// PatchReq sends an authenticated HTTP PATCH request to the Apillon API.
+//
+// Parameters:
+//   - path: The API endpoint path (e.g., "/storage/buckets/{uuid}").
+//   - body: The request body as an io.Reader (should be JSON).
+//
+// Returns:
+//   - string: The response body as a string.
+//   - error: An error if the request fails or the response cannot be read.
+func PatchReq(path string, body io.Reader) (string, error) {
+	url := "https://api.apillon.io" + path
+
+	req, err := http.NewRequest("PATCH", url, body)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Basic "+getAPIKey())
+
+	client := &http.Client{
+		Timeout: 30 * 1e9, // 30 seconds
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(responseBody), nil
+}
+
 // DeleteReq sends an authenticated HTTP DELETE request to the Apillon API.
 //
 // Parameters:
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+)
+
+// ArchiveFormat identifies the container format read by UploadArchive.
+type ArchiveFormat string
+
+const (
+	ArchiveTar   ArchiveFormat = "tar"    // Uncompressed tar
+	ArchiveTarGz ArchiveFormat = "tar.gz" // Gzip-compressed tar
+	ArchiveZip   ArchiveFormat = "zip"    // Zip
+)
+
+// ErrUnsafeArchivePath is returned when an archive entry would escape the upload root.
+var ErrUnsafeArchivePath = errors.New("unsafe archive entry path")
+
+// ArchiveOptions configures UploadArchive.
+type ArchiveOptions struct {
+	RemotePath      string        // Directory in the bucket the entries are uploaded to; defaults to the bucket root
+	StripComponents int           // Number of leading path elements removed from entry names, like tar --strip-components
+	Upload          UploadOptions // Options for the upload process
+}
+
+// UploadArchive uploads the files contained in a tar, tar.gz or zip archive without extracting it to disk.
+// Entry names are mapped to the fileName and path of each file below opts.RemotePath. Directories,
+// symbolic links, other special entries and empty files are skipped. Entries with absolute names or ".."
+// elements are rejected with ErrUnsafeArchivePath before anything is uploaded.
+// Every entry is read into memory before the upload starts, so the archive can be checked as a whole
+// and split into sessions like any other set of files: memory use grows with the total uncompressed
+// size of the uploaded entries, plus the whole compressed file for zip archives, whose index is stored
+// at the end. Split very large archives, or extract them and use UploadDirectory instead.
+// Returns an UploadResult describing every file, or an error.
+func UploadArchive(bucketUuid string, reader io.Reader, format ArchiveFormat, opts ArchiveOptions) (UploadResult, error) {
+	if bucketUuid == "" {
+		return UploadResult{}, fmt.Errorf("bucket uuid is required")
+	}
+	if reader == nil {
+		return UploadResult{}, fmt.Errorf("archive reader is required")
+	}
+
+	files, err := readArchive(reader, format, opts)
+	if err != nil {
+		log.Printf("Failed to read %s archive for bucket %s: %v", format, bucketUuid, err)
+		return UploadResult{}, err
+	}
+	if len(files) == 0 {
+		return UploadResult{}, fmt.Errorf("no files to upload in %s archive", format)
+	}
+
+	log.Printf("Uploading %d files from %s archive to bucket %s", len(files), format, bucketUuid)
+	return UploadFileProcessWithOptions(bucketUuid, files, opts.Upload)
+}
+
+// readArchive reads the content of every regular file of an archive into memory.
+func readArchive(reader io.Reader, format ArchiveFormat, opts ArchiveOptions) ([]WholeFile, error) {
+	switch format {
+	case ArchiveTar:
+		return readTar(reader, opts)
+	case ArchiveTarGz:
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		return readTar(gz, opts)
+	case ArchiveZip:
+		return readZip(reader, opts)
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+func readTar(reader io.Reader, opts ArchiveOptions) ([]WholeFile, error) {
+	var files []WholeFile
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar entry: %w", err)
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		meta, ok, err := archiveEntryMetadata(hdr.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar entry %s: %w", hdr.Name, err)
+		}
+		files = appendArchiveFile(files, meta, content)
+	}
+}
+
+func readZip(reader io.Reader, opts ArchiveOptions) ([]WholeFile, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip archive: %w", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %w", err)
+	}
+
+	var files []WholeFile
+	for _, entry := range zr.File {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		meta, ok, err := archiveEntryMetadata(entry.Name, opts)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip entry %s: %w", entry.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip entry %s: %w", entry.Name, err)
+		}
+		files = appendArchiveFile(files, meta, content)
+	}
+	return files, nil
+}
+
+// archiveEntryMetadata maps an entry name to upload metadata. It reports false for entries
+// that are skipped, and an error wrapping ErrUnsafeArchivePath for entries escaping the root.
+func archiveEntryMetadata(name string, opts ArchiveOptions) (FileMetadata, bool, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(name) || (len(name) > 1 && name[1] == ':') {
+		return FileMetadata{}, false, fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return FileMetadata{}, false, fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+		}
+	}
+
+	elems := strings.Split(strings.Trim(path.Clean(name), "/"), "/")
+	if len(elems) <= opts.StripComponents {
+		return FileMetadata{}, false, nil
+	}
+	elems = elems[opts.StripComponents:]
+
+	fileName := elems[len(elems)-1]
+	if fileName == "" || fileName == "." {
+		return FileMetadata{}, false, nil
+	}
+	dir := path.Join(strings.Trim(opts.RemotePath, "/"), path.Join(elems[:len(elems)-1]...))
+	return FileMetadata{FileName: fileName, Path: dir}, true, nil
+}
+
+// appendArchiveFile adds an archive entry to files, skipping empty entries which cannot be uploaded.
+func appendArchiveFile(files []WholeFile, meta FileMetadata, content []byte) []WholeFile {
+	if len(content) == 0 {
+		log.Printf("Skipping empty archive entry %s", localFilePath(meta))
+		return files
+	}
+	return append(files, WholeFile{Metadata: meta, Content: string(content)})
+}
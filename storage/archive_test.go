@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReadArchive_TarGz(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	entries := []struct {
+		hdr     tar.Header
+		content string
+	}{
+		{tar.Header{Name: "dist/", Typeflag: tar.TypeDir, Mode: 0o755}, ""},
+		{tar.Header{Name: "dist/index.html", Typeflag: tar.TypeReg, Mode: 0o644}, "<html></html>"},
+		{tar.Header{Name: "dist/assets/app.js", Typeflag: tar.TypeReg, Mode: 0o644}, "console.log(1)"},
+		{tar.Header{Name: "dist/link.js", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}, ""},
+	}
+	for _, e := range entries {
+		e.hdr.Size = int64(len(e.content))
+		if err := tw.WriteHeader(&e.hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+
+	files, err := readArchive(&buf, ArchiveTarGz, ArchiveOptions{RemotePath: "/releases/v1/", StripComponents: 1})
+	if err != nil {
+		t.Fatalf("readArchive returned error: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, f := range files {
+		got[localFilePath(f.Metadata)] = f.Content
+	}
+	want := map[string]string{
+		"releases/v1/index.html":    "<html></html>",
+		"releases/v1/assets/app.js": "console.log(1)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readArchive returned %v, want %v", got, want)
+	}
+}
+
+func TestReadArchive_ZipRejectsTraversal(t *testing.T) {
+	for _, name := range []string{"../evil.sh", "safe/../../evil.sh", `..\evil.bat`, "/etc/cron.d/evil"} {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("payload"))
+		zw.Close()
+
+		_, err = readArchive(&buf, ArchiveZip, ArchiveOptions{})
+		if !errors.Is(err, ErrUnsafeArchivePath) {
+			t.Errorf("readArchive(%q) error = %v, want ErrUnsafeArchivePath", name, err)
+		}
+	}
+}
+
+func TestReadArchive_Zip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Create("docs/")
+	w, _ := zw.Create("docs/readme.md")
+	w.Write([]byte("# hello"))
+	zw.Create("empty.txt")
+	zw.Close()
+
+	files, err := readArchive(&buf, ArchiveZip, ArchiveOptions{})
+	if err != nil {
+		t.Fatalf("readArchive returned error: %v", err)
+	}
+	if len(files) != 1 || files[0].Metadata.FileName != "readme.md" || files[0].Metadata.Path != "docs" {
+		t.Errorf("unexpected files: %+v", files)
+	}
+}
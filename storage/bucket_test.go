@@ -13,7 +13,7 @@ func TestCreateAndGetBucket(t *testing.T) {
 	description := "Test bucket for unit testing"
 
 	t.Run("CreateBucket", func(t *testing.T) {
-		err := CreateBucket(bucketName, description)
+		_, err := CreateBucket(bucketName, description)
 		if err != nil {
 			t.Errorf("CreateBucket failed: %v", err)
 		}
@@ -50,7 +50,7 @@ func TestGetBucketWithEmptyName(t *testing.T) {
 func TestCreateBucketWithoutDescription(t *testing.T) {
 	bucketName := "test-bucket-no-desc-" + time.Now().Format("20060102150405")
 
-	err := CreateBucket(bucketName, "")
+	_, err := CreateBucket(bucketName, "")
 	if err != nil {
 		t.Errorf("CreateBucket without description failed: %v", err)
 	}
@@ -61,7 +61,7 @@ func TestUploadFileProcess(t *testing.T) {
 	bucketName := "test-upload-bucket-" + time.Now().Format("20060102150405")
 	description := "Test bucket for file upload testing"
 
-	err := CreateBucket(bucketName, description)
+	_, err := CreateBucket(bucketName, description)
 	if err != nil {
 		t.Fatalf("Failed to create test bucket: %v", err)
 	}
@@ -99,10 +99,10 @@ func TestUploadFileProcess(t *testing.T) {
 		if err != nil {
 			t.Errorf("UploadFileProcess failed for single file: %v", err)
 		}
-		if result == "" {
+		if len(result.Files) == 0 {
 			t.Error("UploadFileProcess returned empty result for single file")
 		}
-		t.Logf("Single file upload result: %s", result)
+		t.Logf("Single file upload result: %+v", result)
 	})
 
 	// t.Run("UploadMultipleFiles", func(t *testing.T) {
@@ -127,7 +127,7 @@ func TestUploadFileProcess(t *testing.T) {
 	// 	if err != nil {
 	// 		t.Errorf("UploadFileProcess failed for multiple files: %v", err)
 	// 	}
-	// 	if result == "" {
+	// 	if len(result.Files) == 0 {
 	// 		t.Error("UploadFileProcess returned empty result for multiple files")
 	// 	}
 	// 	t.Logf("Multiple files upload result: %s", result)
@@ -224,7 +224,7 @@ func TestUploadFileProcessEdgeCases(t *testing.T) {
 		if err != nil {
 			t.Logf("Large file upload failed (this might be expected): %v", err)
 		} else {
-			t.Logf("Large file upload succeeded: %s", result)
+			t.Logf("Large file upload succeeded: %+v", result)
 		}
 	})
 
@@ -245,7 +245,7 @@ func TestUploadFileProcessEdgeCases(t *testing.T) {
 		if err != nil {
 			t.Logf("Special characters filename upload failed: %v", err)
 		} else {
-			t.Logf("Special characters filename upload succeeded: %s", result)
+			t.Logf("Special characters filename upload succeeded: %+v", result)
 		}
 	})
 }
@@ -343,33 +343,33 @@ func TestUploadFileToExistingBucketByName(t *testing.T) {
 		return
 	}
 
-	if result == "" {
+	if len(result.Files) == 0 {
 		t.Error("UploadFileProcess returned empty result")
 		return
 	}
 
-	t.Logf("Successfully uploaded %d files to bucket '%s': %s",
+	t.Logf("Successfully uploaded %d files to bucket '%s': %+v",
 		len(testFiles), bucketName, result)
 
 	// Verify the upload was successful by checking the result
 	// (You might want to add additional verification here based on your API response format)
-	if !strings.Contains(result, "success") && !strings.Contains(result, "completed") {
-		t.Logf("Upload result may indicate issues: %s", result)
+	if failed := result.Failed(); len(failed) > 0 {
+		t.Logf("Upload result may indicate issues: %+v", failed)
 	}
 }
 
 // Helper function to upload files to a bucket by name (convenience wrapper)
-func UploadFilesToBucketByName(bucketName string, files []WholeFile, t *testing.T) (string, error) {
+func UploadFilesToBucketByName(bucketName string, files []WholeFile, t *testing.T) (UploadResult, error) {
 	// Get bucket details by name
 	bucketRes, err := GetBucket(bucketName)
 	if err != nil {
-		return "", fmt.Errorf("failed to get bucket '%s': %w", bucketName, err)
+		return UploadResult{}, fmt.Errorf("failed to get bucket '%s': %w", bucketName, err)
 	}
 
 	// Extract bucket UUID
 	bucketUuid, err := extractBucketUuid(bucketRes, bucketName, t)
 	if err != nil || bucketUuid == "" {
-		return "", fmt.Errorf("failed to extract UUID for bucket '%s': %w", bucketName, err)
+		return UploadResult{}, fmt.Errorf("failed to extract UUID for bucket '%s': %w", bucketName, err)
 	}
 
 	// Upload files using the UUID
@@ -382,7 +382,7 @@ func TestUploadFileToExistingBucketByNameWithHelper(t *testing.T) {
 	description := "Test bucket for helper function"
 
 	// Create bucket
-	err := CreateBucket(bucketName, description)
+	_, err := CreateBucket(bucketName, description)
 	if err != nil {
 		t.Fatalf("Failed to create test bucket: %v", err)
 	}
@@ -407,7 +407,7 @@ func TestUploadFileToExistingBucketByNameWithHelper(t *testing.T) {
 		return
 	}
 
-	t.Logf("Helper function successfully uploaded file to bucket '%s': %s", bucketName, result)
+	t.Logf("Helper function successfully uploaded file to bucket '%s': %+v", bucketName, result)
 }
 
 func TestEndSessionManual(t *testing.T) {
@@ -421,7 +421,7 @@ func TestEndSessionManual(t *testing.T) {
 		return
 	}
 
-	t.Logf("EndSession result: %s", result)
+	t.Logf("EndSession result: %+v", result)
 }
 
 func TestCompleteFileLifecycle(t *testing.T) {
@@ -429,7 +429,7 @@ func TestCompleteFileLifecycle(t *testing.T) {
 	bucketName := "lifecycle-test-bucket-" + time.Now().Format("20060102150405")
 	description := "Test bucket for complete file lifecycle testing"
 
-	err := CreateBucket(bucketName, description)
+	_, err := CreateBucket(bucketName, description)
 	if err != nil {
 		t.Fatalf("Failed to create test bucket: %v", err)
 	}
@@ -480,11 +480,11 @@ func TestCompleteFileLifecycle(t *testing.T) {
 			t.Fatalf("Failed to upload files to bucket '%s': %v", bucketName, err)
 		}
 
-		if result == "" {
+		if len(result.Files) == 0 {
 			t.Fatal("UploadFileProcess returned empty result")
 		}
 
-		t.Logf("Successfully uploaded %d files to bucket '%s': %s", len(testFiles), bucketName, result)
+		t.Logf("Successfully uploaded %d files to bucket '%s': %+v", len(testFiles), bucketName, result)
 	})
 
 	// Give some time for files to be processed
@@ -605,12 +605,12 @@ func TestCompleteFileLifecycle(t *testing.T) {
 			return
 		}
 
-		if content == "" {
+		if len(content.Data.Items) == 0 {
 			t.Error("Bucket content should not be empty")
 			return
 		}
 
-		t.Logf("Bucket content retrieved successfully, length: %d characters", len(content))
+		t.Logf("Bucket content retrieved successfully, %d items", len(content.Data.Items))
 	})
 }
 
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressionMinSize is the smallest file compressed before upload, in bytes.
+const DefaultCompressionMinSize = 1024
+
+// DefaultCompressionMinSavings is the fraction of its size a file must shrink by for the compressed
+// version to be uploaded instead of the original.
+const DefaultCompressionMinSavings = 0.1
+
+// DefaultCompressibleTypes are the content types compressed by default. Entries ending in "/"
+// match every subtype, and "+json" and "+xml" structured syntax suffixes are matched as well.
+// Formats that are already compressed, like PNG, MP4 or zip, are deliberately not listed.
+var DefaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/x-ndjson",
+	"application/xml",
+	"application/javascript",
+	"application/wasm",
+	"application/x-tar",
+	"image/svg+xml",
+}
+
+// CompressionMarker is inserted before the compressor's extension in the name of compressed files,
+// e.g. "app.js" is stored as "app.js.apillon.gz". Only names carrying it are decompressed on download,
+// so ordinary files such as "backup.tar.gz" are left alone.
+const CompressionMarker = ".apillon"
+
+// Compressor compresses file content before upload. The encoding is recorded by appending
+// CompressionMarker and Extension to the file name, so registered compressors are picked again on download.
+type Compressor interface {
+	Extension() string   // File name suffix recording the encoding, e.g. ".gz"
+	ContentType() string // Content type of the compressed file, e.g. "application/gzip"
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCompressor compresses content with gzip.
+type GzipCompressor struct {
+	Level int // Compression level; zero means gzip.DefaultCompression
+}
+
+// Extension returns ".gz".
+func (GzipCompressor) Extension() string { return ".gz" }
+
+// ContentType returns "application/gzip".
+func (GzipCompressor) ContentType() string { return "application/gzip" }
+
+// NewWriter returns a gzip writer at the configured level.
+func (c GzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if c.Level == 0 {
+		return gzip.NewWriter(w), nil
+	}
+	return gzip.NewWriterLevel(w, c.Level)
+}
+
+// NewReader returns a gzip reader.
+func (GzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{".gz": GzipCompressor{}}
+)
+
+// RegisterCompressor makes c available for decompressing downloads whose name ends in CompressionMarker
+// followed by its extension.
+// Gzip is registered by default; register other encodings, such as zstd, before downloading them.
+func RegisterCompressor(c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[strings.ToLower(c.Extension())] = c
+}
+
+// compressorFor returns the registered compressor whose marked extension ends name, with the
+// length of that suffix.
+func compressorFor(name string) (Compressor, int, bool) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	lower := strings.ToLower(name)
+	var found Compressor
+	var suffix int
+	for ext, c := range compressors {
+		marked := CompressionMarker + ext
+		if strings.HasSuffix(lower, marked) && len(name) > len(marked) && len(marked) > suffix {
+			found, suffix = c, len(marked)
+		}
+	}
+	return found, suffix, found != nil
+}
+
+// CompressionOptions configures compression of files before upload.
+type CompressionOptions struct {
+	Compressor   Compressor // Defaults to GzipCompressor
+	ContentTypes []string   // Content types that are compressed; defaults to DefaultCompressibleTypes
+	MinSize      int        // Files smaller than this are uploaded as is; defaults to DefaultCompressionMinSize
+	MinSavings   float64    // Required relative size reduction; defaults to DefaultCompressionMinSavings
+}
+
+// compressFiles returns a copy of files where eligible files are compressed, renamed with
+// CompressionMarker and the compressor's extension and given its content type. Files that are too
+// small, have other content types or do not shrink enough are left unchanged.
+// Returns an error if a compressed name clashes with another file of the upload.
+func compressFiles(files []WholeFile, opts *CompressionOptions) ([]WholeFile, error) {
+	if opts == nil {
+		return files, nil
+	}
+	c := opts.Compressor
+	if c == nil {
+		c = GzipCompressor{}
+	}
+	types := opts.ContentTypes
+	if types == nil {
+		types = DefaultCompressibleTypes
+	}
+	minSize := opts.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+	minSavings := opts.MinSavings
+	if minSavings <= 0 {
+		minSavings = DefaultCompressionMinSavings
+	}
+
+	compressed := make([]WholeFile, len(files))
+	for i, file := range files {
+		compressed[i] = file
+		if len(file.Content) < minSize || !compressible(file.Metadata.ContentType, types) {
+			continue
+		}
+
+		var buf bytes.Buffer
+		w, err := c.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(w, file.Content); err != nil {
+			return nil, fmt.Errorf("failed to compress file %s: %w", file.Metadata.FileName, err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress file %s: %w", file.Metadata.FileName, err)
+		}
+
+		if float64(buf.Len()) > float64(len(file.Content))*(1-minSavings) {
+			log.Printf("Uploading %s uncompressed, compression saved too little", file.Metadata.FileName)
+			continue
+		}
+		compressed[i].Content = buf.String()
+		compressed[i].Metadata.FileName = file.Metadata.FileName + CompressionMarker + c.Extension()
+		compressed[i].Metadata.ContentType = c.ContentType()
+	}
+
+	names := make(map[string]bool, len(compressed))
+	for _, file := range compressed {
+		p := localFilePath(file.Metadata)
+		if names[p] {
+			return nil, fmt.Errorf("compressed file name %s clashes with another file of the upload", p)
+		}
+		names[p] = true
+	}
+	return compressed, nil
+}
+
+// compressible reports whether contentType matches one of types.
+func compressible(contentType string, types []string) bool {
+	contentType, _, _ = strings.Cut(strings.ToLower(contentType), ";")
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "" {
+		return false
+	}
+	for _, t := range types {
+		if contentType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(contentType, t)) {
+			return true
+		}
+	}
+	return strings.HasSuffix(contentType, "+json") || strings.HasSuffix(contentType, "+xml")
+}
+
+// NewDecompressingReader returns a reader that decompresses r when name ends in CompressionMarker and
+// the extension of a registered Compressor, along with the name without them. Other content is
+// returned as is.
+func NewDecompressingReader(name string, r io.Reader) (io.ReadCloser, string, error) {
+	c, suffix, ok := compressorFor(name)
+	if !ok {
+		return io.NopCloser(r), name, nil
+	}
+	dr, err := c.NewReader(r)
+	if err != nil {
+		return nil, name, fmt.Errorf("failed to decompress %s: %w", name, err)
+	}
+	return dr, name[:len(name)-suffix], nil
+}
+
+// DownloadDecompressed downloads a file from the Link of its FileInfo (or a generated IPFS link)
+// and writes its content to w, decompressing files uploaded with compression.
+// Returns the original file name or an error if the download or decompression fails.
+func DownloadDecompressed(info FileInfo, w io.Writer) (string, error) {
+	link, err := fileLink(info)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := openLink(link)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	r, name, err := NewDecompressingReader(info.Name, body)
+	if err != nil {
+		log.Printf("Failed to decompress file %s: %v", info.FileUUID, err)
+		return "", err
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		log.Printf("Failed to decompress file %s: %v", info.FileUUID, err)
+		return "", err
+	}
+	return name, nil
+}
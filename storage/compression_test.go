@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestCompressFiles(t *testing.T) {
+	data := strings.Repeat(`{"key":"value"},`, 200)
+	noise := make([]byte, 4096)
+	rand.Read(noise)
+
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "data.json", ContentType: "application/json"}, Content: data},
+		{Metadata: FileMetadata{FileName: "logo.png", ContentType: "image/png"}, Content: data},
+		{Metadata: FileMetadata{FileName: "small.txt", ContentType: "text/plain"}, Content: "tiny"},
+		{Metadata: FileMetadata{FileName: "random.txt", ContentType: "text/plain; charset=utf-8"}, Content: string(noise)},
+		{Metadata: FileMetadata{FileName: "feed.xml", ContentType: "application/atom+xml"}, Content: data},
+	}
+
+	got, err := compressFiles(files, &CompressionOptions{})
+	if err != nil {
+		t.Fatalf("compressFiles returned error: %v", err)
+	}
+
+	wantNames := []string{"data.json.apillon.gz", "logo.png", "small.txt", "random.txt", "feed.xml.apillon.gz"}
+	for i, f := range got {
+		if f.Metadata.FileName != wantNames[i] {
+			t.Errorf("file %d name = %s, want %s", i, f.Metadata.FileName, wantNames[i])
+		}
+	}
+	if got[0].Metadata.ContentType != "application/gzip" || len(got[0].Content) >= len(data) {
+		t.Errorf("data.json was not compressed: %+v", got[0].Metadata)
+	}
+	if files[0].Metadata.FileName != "data.json" {
+		t.Error("compressFiles modified its input")
+	}
+
+	r, name, err := NewDecompressingReader(got[0].Metadata.FileName, strings.NewReader(got[0].Content))
+	if err != nil {
+		t.Fatalf("NewDecompressingReader returned error: %v", err)
+	}
+	content, _ := io.ReadAll(r)
+	if name != "data.json" || string(content) != data {
+		t.Errorf("decompressed %q to different content", name)
+	}
+}
+
+func TestDownloadDecompressed(t *testing.T) {
+	defer gock.Off()
+
+	files, err := compressFiles([]WholeFile{
+		{Metadata: FileMetadata{FileName: "notes.md", ContentType: "text/markdown"}, Content: strings.Repeat("# notes\n", 500)},
+	}, &CompressionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gock.New("https://gateway.example.com").Get("/notes").Reply(200).Body(strings.NewReader(files[0].Content))
+	gock.New("https://gateway.example.com").Get("/plain").Reply(200).BodyString("as is")
+	gock.New("https://gateway.example.com").Get("/backup").Reply(200).BodyString("not gzip")
+
+	var out bytes.Buffer
+	name, err := DownloadDecompressed(FileInfo{Name: "notes.md.apillon.gz", Link: "https://gateway.example.com/notes"}, &out)
+	if err != nil {
+		t.Fatalf("DownloadDecompressed returned error: %v", err)
+	}
+	if name != "notes.md" || out.String() != strings.Repeat("# notes\n", 500) {
+		t.Errorf("unexpected download %q", name)
+	}
+
+	out.Reset()
+	name, err = DownloadDecompressed(FileInfo{Name: "plain.txt", Link: "https://gateway.example.com/plain"}, &out)
+	if err != nil || name != "plain.txt" || out.String() != "as is" {
+		t.Errorf("uncompressed download = %q, %q, %v", name, out.String(), err)
+	}
+
+	// A .gz file uploaded as is is not mistaken for a compressed upload
+	out.Reset()
+	name, err = DownloadDecompressed(FileInfo{Name: "backup.tar.gz", Link: "https://gateway.example.com/backup"}, &out)
+	if err != nil || name != "backup.tar.gz" || out.String() != "not gzip" {
+		t.Errorf("plain .gz download = %q, %q, %v", name, out.String(), err)
+	}
+}
+
+func TestCompressFiles_NameClash(t *testing.T) {
+	data := strings.Repeat(`{"key":"value"},`, 200)
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "a.json", Path: "docs", ContentType: "application/json"}, Content: data},
+		{Metadata: FileMetadata{FileName: "a.json.apillon.gz", Path: "docs/", ContentType: "application/gzip"}, Content: "gz"},
+	}
+	if _, err := compressFiles(files, &CompressionOptions{}); err == nil || !strings.Contains(err.Error(), "docs/a.json.apillon.gz") {
+		t.Errorf("expected the name clash to be rejected, got %v", err)
+	}
+
+	files[1].Metadata.FileName = "a.json.gz"
+	if _, err := compressFiles(files, &CompressionOptions{}); err != nil {
+		t.Errorf("compressFiles returned error for distinct names: %v", err)
+	}
+}
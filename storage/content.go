@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LeonardoRyuta/apillon-storage/requests"
+)
+
+// ContentItemType distinguishes directories from files in bucket content listings.
+type ContentItemType int
+
+const (
+	ContentDirectory ContentItemType = 1 // A directory
+	ContentFile      ContentItemType = 2 // A file
+)
+
+// String returns "directory" or "file".
+func (t ContentItemType) String() string {
+	switch t {
+	case ContentDirectory:
+		return "directory"
+	case ContentFile:
+		return "file"
+	default:
+		return "unknown(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// ContentItem is a file or directory in a bucket, as returned by the /content endpoint.
+type ContentItem struct {
+	Timestamps
+	Type        ContentItemType `json:"type"`                          // Directory or file
+	UUID        string          `json:"uuid"`                          // Unique identifier of the file or directory
+	Name        string          `json:"name"`                          // Name of the file or directory
+	CID         string          `json:"CID"`                           // Content Identifier (CID) for IPFS
+	Size        int64           `json:"size"`                          // Size of the file in bytes
+	ContentType string          `json:"contentType"`                   // MIME type of the file
+	FileStatus  FileStatus      `json:"fileStatus"`                    // Processing status of the file
+	Link        string          `json:"link"`                          // URL or IPFS link to the file
+	ParentUUID  string          `json:"parentDirectoryUuid,omitempty"` // UUID of the parent directory, empty at the bucket root
+}
+
+// IsDir reports whether the item is a directory.
+func (c ContentItem) IsDir() bool {
+	return c.Type == ContentDirectory
+}
+
+// BucketContentResponse represents a response containing a page of bucket content.
+type BucketContentResponse = APIResponse[ListData[ContentItem]]
+
+// ContentOptions selects the directory and page of bucket content to list.
+type ContentOptions struct {
+	DirectoryUUID string // Directory to list; empty for the bucket root
+	Search        string // Only items whose name contains this text
+	Page          int    // Page to list, starting at 1
+	Limit         int    // Number of items per page
+	OrderBy       string // Field to order by, e.g. "name"
+	Desc          bool   // Order descending instead of ascending
+}
+
+// GetBucketContent retrieves the first page of files and directories at the root of a bucket.
+// Returns a BucketContentResponse or an error if the request or unmarshalling fails.
+func GetBucketContent(bucketUuid string) (BucketContentResponse, error) {
+	return ListBucketContent(bucketUuid, ContentOptions{})
+}
+
+// ListBucketContent retrieves one page of the files and directories in a bucket directory.
+// Returns a BucketContentResponse or an error if the request or unmarshalling fails.
+func ListBucketContent(bucketUuid string, opts ContentOptions) (BucketContentResponse, error) {
+	if bucketUuid == "" {
+		return BucketContentResponse{}, fmt.Errorf("bucket uuid is required")
+	}
+
+	params := map[string]string{}
+	if opts.DirectoryUUID != "" {
+		params["directoryUuid"] = opts.DirectoryUUID
+	}
+	if opts.Search != "" {
+		params["search"] = opts.Search
+	}
+	if opts.Page > 0 {
+		params["page"] = strconv.Itoa(opts.Page)
+	}
+	if opts.Limit > 0 {
+		params["limit"] = strconv.Itoa(opts.Limit)
+	}
+	if opts.OrderBy != "" {
+		params["orderBy"] = opts.OrderBy
+	}
+	if opts.Desc {
+		params["desc"] = "true"
+	}
+
+	path := "/storage/buckets/" + bucketUuid + "/content"
+
+	res, err := requests.GetReq(path, params)
+	if err != nil {
+		log.Printf("Failed to get bucket content %s: %v", bucketUuid, err)
+		return BucketContentResponse{}, err
+	}
+
+	var content BucketContentResponse
+	if errUnmarshal := json.Unmarshal([]byte(res), &content); errUnmarshal != nil {
+		log.Printf("Failed to unmarshal JSON response from bucket content %s: %v. Raw response: %s", bucketUuid, errUnmarshal, res)
+		return BucketContentResponse{}, fmt.Errorf("failed to unmarshal bucket content response: %w. Raw response: %s", errUnmarshal, res)
+	}
+	for i := range content.Data.Items {
+		if content.Data.Items[i].ParentUUID == "" {
+			content.Data.Items[i].ParentUUID = opts.DirectoryUUID
+		}
+	}
+
+	log.Printf("Listed %d of %d items in bucket %s", len(content.Data.Items), content.Data.Total, bucketUuid)
+	return content, nil
+}
+
+// listDirectory returns every item in a bucket directory, walking all pages, sorted by name.
+func listDirectory(bucketUuid string, directoryUuid string) ([]ContentItem, error) {
+	opts := ContentOptions{DirectoryUUID: directoryUuid, Page: 1, Limit: DefaultListPageSize}
+	var items []ContentItem
+	for {
+		resp, err := ListBucketContent(bucketUuid, opts)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, resp.Data.Items...)
+		if len(resp.Data.Items) < opts.Limit || opts.Page*opts.Limit >= resp.Data.Total {
+			break
+		}
+		opts.Page++
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+// WalkContentFunc is called by WalkBucketContent for every file and directory. path is the slash-separated
+// path of the item from the starting directory. Like fs.WalkDirFunc, it is called a second time for a
+// directory whose content cannot be listed, with err set; returning nil then skips the directory.
+// Returning fs.SkipDir skips the directory being visited (or the rest of the file's directory),
+// and fs.SkipAll stops the walk.
+type WalkContentFunc func(path string, item ContentItem, err error) error
+
+// WalkBucketContent walks the files and directories of a bucket below directoryUuid (the bucket root if empty),
+// calling fn for each item in lexical order and descending into directories by their UUID.
+// The starting directory itself is not passed to fn. Directories are listed as the walk reaches them.
+// Returns the error returned by fn, or the error listing the starting directory.
+func WalkBucketContent(bucketUuid string, directoryUuid string, fn WalkContentFunc) error {
+	items, err := listDirectory(bucketUuid, directoryUuid)
+	if err != nil {
+		return err
+	}
+	err = walkContent(bucketUuid, "", items, fn, map[string]bool{directoryUuid: true})
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// walkContent visits items of the directory at dir and recurses into subdirectories.
+// visited guards against directories listed as their own descendants.
+func walkContent(bucketUuid string, dir string, items []ContentItem, fn WalkContentFunc, visited map[string]bool) error {
+	for _, item := range items {
+		p := path.Join(dir, item.Name)
+		if err := fn(p, item, nil); err != nil {
+			if errors.Is(err, fs.SkipDir) && item.IsDir() {
+				continue
+			}
+			return err
+		}
+		if !item.IsDir() || visited[item.UUID] {
+			continue
+		}
+		visited[item.UUID] = true
+
+		children, err := listDirectory(bucketUuid, item.UUID)
+		if err != nil {
+			if err := fn(p, item, err); err != nil {
+				if errors.Is(err, fs.SkipDir) {
+					continue
+				}
+				return err
+			}
+			continue
+		}
+		if err := walkContent(bucketUuid, p, children, fn, visited); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ContentNode is a file or directory in a content tree built by BuildContentTree.
+type ContentNode struct {
+	ContentItem
+	Path     string         // Slash-separated path from the tree root; empty for the root
+	Children []*ContentNode // Items in the directory, sorted by name; nil for files
+}
+
+// Find returns the node at the slash-separated path below n, or nil if there is none.
+func (n *ContentNode) Find(p string) *ContentNode {
+	node := n
+	for _, name := range splitPath(p) {
+		var next *ContentNode
+		for _, child := range node.Children {
+			if child.Name == name {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// BuildContentTree lists a bucket directory (the bucket root if directoryUuid is empty) and all its
+// subdirectories, and returns them as a tree. The returned root is a directory node with an empty path.
+// Returns an error if any directory cannot be listed, or if an item's name does not let it be placed
+// below its directory.
+func BuildContentTree(bucketUuid string, directoryUuid string) (*ContentNode, error) {
+	root := &ContentNode{ContentItem: ContentItem{Type: ContentDirectory, UUID: directoryUuid}}
+	nodes := map[string]*ContentNode{"": root}
+
+	err := WalkBucketContent(bucketUuid, directoryUuid, func(p string, item ContentItem, err error) error {
+		if err != nil {
+			return err
+		}
+		node := &ContentNode{ContentItem: item, Path: p}
+		parent := nodes[parentPath(p, item.Name)]
+		if parent == nil {
+			return fmt.Errorf("cannot place %s in the content tree: its parent directory was not listed", p)
+		}
+		parent.Children = append(parent.Children, node)
+		if item.IsDir() {
+			nodes[p] = node
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to build content tree for bucket %s: %v", bucketUuid, err)
+		return nil, err
+	}
+	return root, nil
+}
+
+// splitPath splits a slash-separated path into its non-empty elements.
+func splitPath(p string) []string {
+	var elems []string
+	for _, e := range strings.Split(p, "/") {
+		if e != "" && e != "." {
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+// parentPath returns the path of the directory holding the item name walked at p, or "" for the root.
+// Names may contain slashes, so the name is stripped from p rather than its last element.
+func parentPath(p string, name string) string {
+	if dir, ok := strings.CutSuffix(p, name); ok && (dir == "" || strings.HasSuffix(dir, "/")) {
+		return strings.TrimSuffix(dir, "/")
+	}
+	if dir := path.Dir(p); dir != "." {
+		return dir
+	}
+	return ""
+}
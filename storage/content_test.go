@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func mockContent(bucketUUID string, directoryUUID string, items []map[string]any) {
+	req := gock.New("https://api.apillon.io").Get("/storage/buckets/" + bucketUUID + "/content")
+	if directoryUUID != "" {
+		req.MatchParam("directoryUuid", "^"+directoryUUID+"$")
+	}
+	req.Reply(200).JSON(map[string]any{"status": 200, "data": map[string]any{"total": len(items), "items": items}})
+}
+
+func mockContentTree(bucketUUID string) {
+	// Directory listings are registered before the root so the root mock does not match them
+	mockContent(bucketUUID, "dir-docs", []map[string]any{
+		{"type": 2, "uuid": "file-b", "name": "b.md", "size": 2},
+		{"type": 1, "uuid": "dir-img", "name": "img"},
+	})
+	mockContent(bucketUUID, "dir-img", []map[string]any{
+		{"type": 2, "uuid": "file-c", "name": "c.png", "size": 3, "CID": "QmC"},
+	})
+	mockContent(bucketUUID, "", []map[string]any{
+		{"type": 2, "uuid": "file-a", "name": "a.txt", "size": 1},
+		{"type": 1, "uuid": "dir-docs", "name": "docs"},
+	})
+}
+
+func TestWalkBucketContent(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockContentTree(bucketUUID)
+
+	var visited []string
+	err := WalkBucketContent(bucketUUID, "", func(p string, item ContentItem, err error) error {
+		if err != nil {
+			return err
+		}
+		visited = append(visited, p+":"+item.Type.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkBucketContent returned error: %v", err)
+	}
+	want := []string{"a.txt:file", "docs:directory", "docs/b.md:file", "docs/img:directory", "docs/img/c.png:file"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %v, want %v", visited, want)
+	}
+}
+
+func TestWalkBucketContent_SkipDir(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockContent(bucketUUID, "", []map[string]any{
+		{"type": 1, "uuid": "dir-docs", "name": "docs"},
+		{"type": 2, "uuid": "file-z", "name": "z.txt"},
+	})
+
+	var visited []string
+	err := WalkBucketContent(bucketUUID, "", func(p string, item ContentItem, err error) error {
+		visited = append(visited, p)
+		if item.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkBucketContent returned error: %v", err)
+	}
+	if !reflect.DeepEqual(visited, []string{"docs", "z.txt"}) {
+		t.Errorf("visited %v", visited)
+	}
+}
+
+func TestBuildContentTree(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockContentTree(bucketUUID)
+
+	root, err := BuildContentTree(bucketUUID, "")
+	if err != nil {
+		t.Fatalf("BuildContentTree returned error: %v", err)
+	}
+	if len(root.Children) != 2 {
+		t.Fatalf("root has %d children, want 2", len(root.Children))
+	}
+
+	c := root.Find("docs/img/c.png")
+	if c == nil || c.UUID != "file-c" || c.CID != "QmC" || c.ParentUUID != "dir-img" || c.Path != "docs/img/c.png" {
+		t.Errorf("unexpected node for docs/img/c.png: %+v", c)
+	}
+	if img := root.Find("/docs/img/"); img == nil || !img.IsDir() || len(img.Children) != 1 {
+		t.Errorf("unexpected node for docs/img: %+v", img)
+	}
+	if root.Find("docs/missing") != nil {
+		t.Error("Find returned a node for a missing path")
+	}
+}
+
+func TestBuildContentTree_UnusualNames(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	// docs is listed again inside itself, and x/y has a slash in its name
+	mockContent(bucketUUID, "dir-docs", []map[string]any{
+		{"type": 1, "uuid": "dir-docs", "name": "again"},
+		{"type": 2, "uuid": "file-b", "name": "b.md", "size": 2},
+	})
+	mockContent(bucketUUID, "dir-xy", []map[string]any{
+		{"type": 2, "uuid": "file-c", "name": "c.txt", "size": 3},
+	})
+	mockContent(bucketUUID, "", []map[string]any{
+		{"type": 1, "uuid": "dir-docs", "name": "docs"},
+		{"type": 1, "uuid": "dir-xy", "name": "x/y"},
+	})
+
+	root, err := BuildContentTree(bucketUUID, "")
+	if err != nil {
+		t.Fatalf("BuildContentTree returned error: %v", err)
+	}
+	if len(root.Children) != 2 {
+		t.Fatalf("root has %d children, want 2", len(root.Children))
+	}
+	if again := root.Find("docs/again"); again == nil || again.UUID != "dir-docs" || len(again.Children) != 0 {
+		t.Errorf("unexpected node for the revisited directory: %+v", again)
+	}
+	xy := root.Children[1]
+	if xy.Name != "x/y" || len(xy.Children) != 1 || xy.Children[0].Path != "x/y/c.txt" {
+		t.Errorf("unexpected node for x/y: %+v", xy)
+	}
+}
+
+func TestBuildContentTree_NameLeavesDirectory(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockContent(bucketUUID, "dir-docs", []map[string]any{
+		{"type": 2, "uuid": "file-b", "name": "x/../../../b.md", "size": 2},
+	})
+	mockContent(bucketUUID, "", []map[string]any{
+		{"type": 1, "uuid": "dir-docs", "name": "docs"},
+	})
+
+	if _, err := BuildContentTree(bucketUUID, ""); err == nil {
+		t.Error("expected an error for a name that leaves its directory")
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// defaultContentType is used when neither the file extension nor the content identify the type.
+const defaultContentType = "application/octet-stream"
+
+// builtinContentTypes maps lower-case file extensions to MIME types.
+// It is consulted before the mime package so results do not depend on the host's mime.types files.
+var builtinContentTypes = map[string]string{
+	".txt":   "text/plain",
+	".md":    "text/markdown",
+	".csv":   "text/csv",
+	".html":  "text/html",
+	".htm":   "text/html",
+	".css":   "text/css",
+	".js":    "text/javascript",
+	".mjs":   "text/javascript",
+	".json":  "application/json",
+	".map":   "application/json",
+	".xml":   "application/xml",
+	".pdf":   "application/pdf",
+	".wasm":  "application/wasm",
+	".zip":   "application/zip",
+	".gz":    "application/gzip",
+	".tar":   "application/x-tar",
+	".car":   "application/vnd.ipld.car",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".avif":  "image/avif",
+	".svg":   "image/svg+xml",
+	".ico":   "image/x-icon",
+	".mp3":   "audio/mpeg",
+	".wav":   "audio/wav",
+	".ogg":   "audio/ogg",
+	".mp4":   "video/mp4",
+	".webm":  "video/webm",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+}
+
+// ContentTypeFunc returns the content type to use for a file about to be uploaded.
+// Returning an empty string falls back to the file's own ContentType or automatic detection.
+type ContentTypeFunc func(metadata FileMetadata, content []byte) string
+
+// ContentTypeByExtension returns the MIME type for the extension of fileName using the built-in
+// table and then the mime package. It returns an empty string if the extension is unknown.
+func ContentTypeByExtension(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext == "" {
+		return ""
+	}
+	if contentType, ok := builtinContentTypes[ext]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// DetectContentType returns the MIME type of a file based on its extension, falling back to
+// sniffing the first 512 bytes of content with http.DetectContentType.
+// Returns "application/octet-stream" when nothing identifies the type.
+func DetectContentType(fileName string, content []byte) string {
+	if contentType := ContentTypeByExtension(fileName); contentType != "" {
+		return contentType
+	}
+	if len(content) == 0 {
+		return defaultContentType
+	}
+	if len(content) > 512 {
+		content = content[:512]
+	}
+	return http.DetectContentType(content)
+}
+
+// resolveContentTypes returns a copy of files where every file has a content type.
+// The hook, when set, overrides the type of any file it returns a value for; remaining files
+// without a content type are detected from their name and content.
+func resolveContentTypes(files []WholeFile, hook ContentTypeFunc) []WholeFile {
+	resolved := make([]WholeFile, len(files))
+	copy(resolved, files)
+
+	for i := range resolved {
+		meta := &resolved[i].Metadata
+		content := []byte(resolved[i].Content)
+		if hook != nil {
+			if contentType := hook(*meta, content); contentType != "" {
+				meta.ContentType = contentType
+				continue
+			}
+		}
+		if meta.ContentType == "" {
+			meta.ContentType = DetectContentType(meta.FileName, content)
+		}
+	}
+	return resolved
+}
@@ -0,0 +1,56 @@
+package storage
+
+import "testing"
+
+func TestDetectContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	tests := []struct {
+		name     string
+		fileName string
+		content  []byte
+		want     string
+	}{
+		{"BuiltinExtension", "logo.PNG", nil, "image/png"},
+		{"JavaScriptBundle", "app.min.js", []byte("console.log(1)"), "text/javascript"},
+		{"ExtensionWinsOverContent", "notes.txt", png, "text/plain"},
+		{"SniffedWithoutExtension", "logo", png, "image/png"},
+		{"SniffedUnknownExtension", "page.unknownext", []byte("<!DOCTYPE html><html></html>"), "text/html; charset=utf-8"},
+		{"EmptyUnknown", "blob", nil, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectContentType(tt.fileName, tt.content); got != tt.want {
+				t.Errorf("DetectContentType(%q) = %q, want %q", tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveContentTypes(t *testing.T) {
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "index.html"}, Content: "<html></html>"},
+		{Metadata: FileMetadata{FileName: "data.bin", ContentType: "application/x-custom"}, Content: "abc"},
+		{Metadata: FileMetadata{FileName: "override.txt"}, Content: "abc"},
+	}
+
+	hook := func(meta FileMetadata, content []byte) string {
+		if meta.FileName == "override.txt" {
+			return "text/x-override"
+		}
+		return ""
+	}
+
+	resolved := resolveContentTypes(files, hook)
+
+	want := []string{"text/html", "application/x-custom", "text/x-override"}
+	for i, contentType := range want {
+		if resolved[i].Metadata.ContentType != contentType {
+			t.Errorf("file %s: content type %q, want %q", resolved[i].Metadata.FileName, resolved[i].Metadata.ContentType, contentType)
+		}
+	}
+	if files[0].Metadata.ContentType != "" {
+		t.Errorf("resolveContentTypes modified the caller's files: %+v", files[0].Metadata)
+	}
+}
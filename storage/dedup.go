@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+)
+
+// UploadPlan classifies local files against the files already stored in a bucket.
+type UploadPlan struct {
+	New       []WholeFile         // Files with no remote counterpart
+	Changed   []WholeFile         // Files whose size or CID differs from the remote file
+	Unchanged []WholeFile         // Files identical to the remote file
+	Remote    map[string]FileInfo // Remote files keyed by their full path in the bucket
+}
+
+// Pending returns the files that need to be uploaded: new files followed by changed files.
+func (p UploadPlan) Pending() []WholeFile {
+	pending := make([]WholeFile, 0, len(p.New)+len(p.Changed))
+	pending = append(pending, p.New...)
+	return append(pending, p.Changed...)
+}
+
+// DedupReport summarises an upload that skipped unchanged files.
+type DedupReport struct {
+	Skipped  int          // Files left untouched because they are unchanged
+	Uploaded int          // New files uploaded
+	Changed  int          // Changed files uploaded again
+	Result   UploadResult // Result of uploading the new and changed files, empty if nothing was uploaded
+}
+
+// PlanUpload lists the files in a bucket and compares them with the local files by path and size,
+// and by CID when the remote file already has one.
+// Returns the resulting UploadPlan or an error if the bucket cannot be listed.
+func PlanUpload(bucketUuid string, files []WholeFile) (UploadPlan, error) {
+	return PlanUploadWithOptions(bucketUuid, files, UploadOptions{})
+}
+
+// PlanUploadWithOptions is PlanUpload for files uploaded with opts: each local file is compared
+// with the remote file it would be stored as, so files compressed by opts.Compression are matched
+// against their compressed name and content. The plan still lists the original local files.
+// With opts.Encryption, stored content differs on every upload and cannot be compared, so every file
+// that already exists remotely is planned as changed and uploaded again.
+// Returns the resulting UploadPlan or an error if the bucket cannot be listed.
+func PlanUploadWithOptions(bucketUuid string, files []WholeFile, opts UploadOptions) (UploadPlan, error) {
+	if bucketUuid == "" {
+		return UploadPlan{}, fmt.Errorf("bucket uuid is required")
+	}
+
+	stored, err := storedFiles(files, opts)
+	if err != nil {
+		return UploadPlan{}, err
+	}
+
+	remoteFiles, err := listBucketFiles(bucketUuid)
+	if err != nil {
+		return UploadPlan{}, err
+	}
+
+	plan := UploadPlan{Remote: make(map[string]FileInfo, len(remoteFiles))}
+	for _, info := range remoteFiles {
+		plan.Remote[remoteFilePath(info)] = info
+	}
+
+	for i, file := range files {
+		remote, ok := plan.Remote[localFilePath(stored[i].Metadata)]
+		switch {
+		case !ok:
+			plan.New = append(plan.New, file)
+		case opts.Encryption == nil && sameContent(stored[i], remote):
+			plan.Unchanged = append(plan.Unchanged, file)
+		default:
+			plan.Changed = append(plan.Changed, file)
+		}
+	}
+
+	log.Printf("Upload plan for bucket %s: %d new, %d changed, %d unchanged", bucketUuid, len(plan.New), len(plan.Changed), len(plan.Unchanged))
+	return plan, nil
+}
+
+// UploadChangedFiles uploads only the files that are new or changed compared to the bucket contents,
+// using the same process and options as UploadFileProcessWithOptions. Files are compared in the form
+// they are stored in, as described in PlanUploadWithOptions; with opts.Encryption nothing is skipped.
+// Returns a DedupReport with the skipped, uploaded and changed counts, or an error along with the
+// report of the planned upload and its partial result.
+func UploadChangedFiles(bucketUuid string, files []WholeFile, opts UploadOptions) (DedupReport, error) {
+	plan, err := PlanUploadWithOptions(bucketUuid, files, opts)
+	if err != nil {
+		return DedupReport{}, err
+	}
+
+	report := DedupReport{
+		Skipped:  len(plan.Unchanged),
+		Uploaded: len(plan.New),
+		Changed:  len(plan.Changed),
+	}
+
+	pending := plan.Pending()
+	if len(pending) == 0 {
+		log.Printf("All %d files in bucket %s are up to date", len(files), bucketUuid)
+		return report, nil
+	}
+
+	report.Result, err = UploadFileProcessWithOptions(bucketUuid, pending, opts)
+	if err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// storedFiles returns files as UploadFileProcessWithOptions stores them with opts, with their content
+// type resolved and compressed by opts.Compression. Encryption is left out because its output differs
+// on every upload; PlanUploadWithOptions never treats encrypted files as unchanged.
+func storedFiles(files []WholeFile, opts UploadOptions) ([]WholeFile, error) {
+	if opts.Compression == nil {
+		return files, nil
+	}
+	return compressFiles(resolveContentTypes(files, opts.ContentTypeFunc), opts.Compression)
+}
+
+// listBucketFiles returns every file stored in a bucket.
+func listBucketFiles(bucketUuid string) ([]FileInfo, error) {
+	return ListAllFilesInBucket(bucketUuid, ListFilesOptions{})
+}
+
+// localFilePath returns the full path of a file in the bucket from its upload metadata.
+func localFilePath(meta FileMetadata) string {
+	return path.Join(strings.Trim(meta.Path, "/"), meta.FileName)
+}
+
+// remoteFilePath returns the full path of a stored file. Apillon reports Path as the virtual
+// directory of the file, the same value given as FileMetadata.Path at upload, so the full path
+// is always that directory joined with the file name.
+func remoteFilePath(info FileInfo) string {
+	if info.Path == nil {
+		return info.Name
+	}
+	return path.Join(strings.Trim(*info.Path, "/"), info.Name)
+}
+
+// sameContent reports whether a local file matches a stored file by size and, when known, CID.
+// A CID that cannot be compared counts as a difference.
+func sameContent(file WholeFile, remote FileInfo) bool {
+	if int64(len(file.Content)) != remote.Size {
+		return false
+	}
+	if remote.CID == "" {
+		return true
+	}
+
+	remoteCid, err := cid.Parse(remote.CID)
+	if err != nil {
+		log.Printf("Treating file %s as changed, its CID %s cannot be parsed: %v", remote.FileUUID, remote.CID, err)
+		return false
+	}
+	v0, v1, err := ComputeCIDs(strings.NewReader(file.Content))
+	if err != nil {
+		return false
+	}
+	return cidMatches(remoteCid, v0, v1)
+}
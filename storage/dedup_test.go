@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestPlanUpload(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	sameCid, err := cid.FromBytes([]byte("same"), cid.V0())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/" + bucketUUID + "/files").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{
+			"total": 3,
+			"items": []map[string]any{
+				{"fileUuid": "1", "name": "same.txt", "path": "docs/", "size": 4, "CID": sameCid.ToV1().String()},
+				{"fileUuid": "2", "name": "size.txt", "path": "docs", "size": 1},
+				{"fileUuid": "3", "name": "content.txt", "size": 4, "CID": sameCid.String()},
+			},
+		}})
+
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "same.txt", Path: "docs"}, Content: "same"},
+		{Metadata: FileMetadata{FileName: "size.txt", Path: "docs/"}, Content: "longer"},
+		{Metadata: FileMetadata{FileName: "content.txt"}, Content: "diff"},
+		{Metadata: FileMetadata{FileName: "new.txt"}, Content: "new"},
+	}
+
+	plan, err := PlanUpload(bucketUUID, files)
+	if err != nil {
+		t.Fatalf("PlanUpload returned error: %v", err)
+	}
+
+	if len(plan.Unchanged) != 1 || plan.Unchanged[0].Metadata.FileName != "same.txt" {
+		t.Errorf("unexpected unchanged files: %+v", plan.Unchanged)
+	}
+	if len(plan.Changed) != 2 {
+		t.Errorf("expected size.txt and content.txt to be changed, got %+v", plan.Changed)
+	}
+	if len(plan.New) != 1 || plan.New[0].Metadata.FileName != "new.txt" {
+		t.Errorf("unexpected new files: %+v", plan.New)
+	}
+	if len(plan.Pending()) != 3 {
+		t.Errorf("expected 3 pending files, got %d", len(plan.Pending()))
+	}
+}
+
+func TestSameContent(t *testing.T) {
+	file := WholeFile{Metadata: FileMetadata{FileName: "a.txt"}, Content: "same"}
+	fileCid, err := cid.FromBytes([]byte("same"), cid.V1())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		remote FileInfo
+		want   bool
+	}{
+		{FileInfo{Size: 4}, true},
+		{FileInfo{Size: 4, CID: fileCid.String()}, true},
+		{FileInfo{Size: 5, CID: fileCid.String()}, false},
+		{FileInfo{Size: 4, CID: "not-a-cid"}, false},
+	} {
+		if got := sameContent(file, tc.remote); got != tc.want {
+			t.Errorf("sameContent(%+v) = %v, want %v", tc.remote, got, tc.want)
+		}
+	}
+}
+
+func TestRemoteFilePath(t *testing.T) {
+	dir := func(p string) *string { return &p }
+	for _, tc := range []struct {
+		path *string
+		name string
+		want string
+	}{
+		{nil, "a.txt", "a.txt"},
+		{dir(""), "a.txt", "a.txt"},
+		{dir("/"), "a.txt", "a.txt"},
+		{dir("docs/"), "a.txt", "docs/a.txt"},
+		{dir("a"), "a", "a/a"},
+		{dir("/x/a/"), "a", "x/a/a"},
+	} {
+		if got := remoteFilePath(FileInfo{Path: tc.path, Name: tc.name}); got != tc.want {
+			t.Errorf("remoteFilePath(%v, %q) = %q, want %q", tc.path, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUploadChangedFiles_Compression(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	files := []WholeFile{{
+		Metadata: FileMetadata{FileName: "data.json", ContentType: "application/json"},
+		Content:  strings.Repeat(`{"key":"value"},`, 200),
+	}}
+	opts := UploadOptions{Compression: &CompressionOptions{}}
+
+	// The first run uploads the compressed file
+	var uploaded []byte
+	mockBucketFiles(bucketUUID, []map[string]any{})
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload$").
+		Reply(200).
+		JSON(map[string]any{
+			"data": map[string]any{
+				"sessionUuid": "session-1",
+				"files":       []map[string]any{{"fileName": "data.json.apillon.gz", "url": "https://s3.example.com/data"}},
+			},
+		})
+	gock.New("https://s3.example.com").
+		Put("/data").
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			var err error
+			uploaded, err = io.ReadAll(req.Body)
+			req.Body = io.NopCloser(bytes.NewReader(uploaded))
+			return err == nil, err
+		}).
+		Reply(200)
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload/session-1/end").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+
+	report, err := UploadChangedFiles(bucketUUID, files, opts)
+	if err != nil || report.Uploaded != 1 {
+		t.Fatalf("first run: report %+v, error %v", report, err)
+	}
+
+	// Re-running against the stored file uploads nothing
+	storedCid, err := cid.FromBytes(uploaded, cid.V0())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "1", "name": "data.json.apillon.gz", "size": len(uploaded), "CID": storedCid.String()},
+	})
+
+	report, err = UploadChangedFiles(bucketUUID, files, opts)
+	if err != nil {
+		t.Fatalf("second run returned error: %v", err)
+	}
+	if report.Skipped != 1 || report.Uploaded != 0 || report.Changed != 0 {
+		t.Errorf("second run should skip the compressed file, got %+v", report)
+	}
+	if !gock.IsDone() {
+		t.Error("expected HTTP requests were not made")
+	}
+}
+
+func TestUploadChangedFiles_FailedUploadKeepsCounts(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "1", "name": "same.txt", "size": 4},
+		{"fileUuid": "2", "name": "changed.txt", "size": 1},
+	})
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload$").
+		Reply(500).
+		JSON(map[string]any{"status": 500, "message": "internal error"})
+
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "same.txt"}, Content: "same"},
+		{Metadata: FileMetadata{FileName: "changed.txt"}, Content: "longer"},
+		{Metadata: FileMetadata{FileName: "new.txt"}, Content: "new"},
+	}
+	report, err := UploadChangedFiles(bucketUUID, files, UploadOptions{})
+	if err == nil {
+		t.Fatal("expected the failed upload to be reported")
+	}
+	if report.Skipped != 1 || report.Uploaded != 1 || report.Changed != 1 {
+		t.Errorf("report lost its counts: %+v", report)
+	}
+}
+
+func TestPlanUploadWithOptions_Encryption(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockBucketFiles(bucketUUID, []map[string]any{{"fileUuid": "1", "name": "same.txt", "size": 4}})
+
+	files := []WholeFile{{Metadata: FileMetadata{FileName: "same.txt"}, Content: "same"}}
+	plan, err := PlanUploadWithOptions(bucketUUID, files, UploadOptions{Encryption: testKeyProvider(t)})
+	if err != nil {
+		t.Fatalf("PlanUploadWithOptions returned error: %v", err)
+	}
+	if len(plan.Changed) != 1 || len(plan.Unchanged) != 0 {
+		t.Errorf("encrypted files should always be uploaded again, got %+v", plan)
+	}
+}
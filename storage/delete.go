@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDeleteConcurrency is the number of files DeleteMatching deletes at the same time.
+const DefaultDeleteConcurrency = 4
+
+// ErrEmptySelector is returned by DeleteMatching when the selector sets no criteria,
+// so that a zero DeleteSelector can never empty a bucket.
+var ErrEmptySelector = errors.New("delete selector has no criteria")
+
+// ErrDryRun marks the files a dry run would have deleted.
+var ErrDryRun = errors.New("dry run")
+
+// ErrUnknownCreateTime marks files skipped by a CreatedBefore cutoff because Apillon did not report
+// when they were created.
+var ErrUnknownCreateTime = errors.New("creation time unknown")
+
+// DeleteSelector chooses the files removed by DeleteMatching. A file is selected when it matches
+// every criterion that is set; at least one must be set.
+type DeleteSelector struct {
+	Glob          string    // Glob on the file path with "*", "?", "[...]" and "**", e.g. "builds/**/*.map"
+	Prefix        string    // Only files whose path starts with this text, e.g. "builds/2024-"
+	ContentType   string    // Only files of this MIME type; "image/*" matches a whole family
+	CreatedBefore time.Time // Only files created before this time
+}
+
+// empty reports whether no criterion is set.
+func (s DeleteSelector) empty() bool {
+	return s.Glob == "" && s.Prefix == "" && s.ContentType == "" && s.CreatedBefore.IsZero()
+}
+
+// DeleteOptions configures DeleteMatchingWithOptions.
+type DeleteOptions struct {
+	Concurrency int  // Files deleted at the same time; defaults to DefaultDeleteConcurrency
+	DryRun      bool // Report the selected files as skipped with ErrDryRun instead of deleting them
+}
+
+// DeletedFile describes a file selected by DeleteMatching.
+type DeletedFile struct {
+	Path     string // Path of the file in the bucket
+	FileUUID string // Unique identifier for the file
+	Size     int64  // Size of the file in bytes
+	Err      error  // Why the file was skipped or not deleted, nil if it was deleted
+}
+
+// DeleteResult describes the outcome of DeleteMatching.
+type DeleteResult struct {
+	BucketUUID string        // UUID of the bucket files were deleted from
+	Deleted    []DeletedFile // Files that were deleted
+	Skipped    []DeletedFile // Files that were not deleted on purpose; Err is ErrDryRun or ErrUnknownCreateTime
+	Failed     []DeletedFile // Files that could not be deleted; Err is a *DeleteFileError
+}
+
+// DeleteFileError is the error of a file DeleteMatching failed to delete.
+type DeleteFileError struct {
+	Path     string // Path of the file in the bucket
+	FileUUID string // Unique identifier for the file
+	Status   int    // Status returned by the API; zero if the request itself failed
+	Err      error  // Underlying error
+}
+
+func (e *DeleteFileError) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("failed to delete %s (%s): status %d: %v", e.Path, e.FileUUID, e.Status, e.Err)
+	}
+	return fmt.Sprintf("failed to delete %s (%s): %v", e.Path, e.FileUUID, e.Err)
+}
+
+func (e *DeleteFileError) Unwrap() error { return e.Err }
+
+// DeleteMatching deletes every file in a bucket selected by selector with the default DeleteOptions.
+func DeleteMatching(bucketUuid string, selector DeleteSelector) (DeleteResult, error) {
+	return DeleteMatchingWithOptions(bucketUuid, selector, DeleteOptions{})
+}
+
+// DeleteMatchingWithOptions lists the files of a bucket and deletes those selected by selector,
+// opts.Concurrency at a time. Files that fail do not stop the others.
+// Returns a DeleteResult listing deleted, skipped and failed files, and the joined
+// *DeleteFileError values of the failed files. Returns ErrEmptySelector if selector sets no criteria.
+func DeleteMatchingWithOptions(bucketUuid string, selector DeleteSelector, opts DeleteOptions) (DeleteResult, error) {
+	if bucketUuid == "" {
+		return DeleteResult{}, fmt.Errorf("bucket uuid is required")
+	}
+	if selector.empty() {
+		return DeleteResult{}, ErrEmptySelector
+	}
+	match, err := selector.matcher()
+	if err != nil {
+		return DeleteResult{}, err
+	}
+
+	remoteFiles, err := listBucketFiles(bucketUuid)
+	if err != nil {
+		return DeleteResult{}, err
+	}
+
+	result := DeleteResult{BucketUUID: bucketUuid}
+	var selected []DeletedFile
+	for _, info := range remoteFiles {
+		if !match(info) {
+			continue
+		}
+		file := DeletedFile{Path: remoteFilePath(info), FileUUID: info.FileUUID, Size: info.Size}
+		switch {
+		case !selector.CreatedBefore.IsZero() && info.CreateTime.IsZero():
+			file.Err = ErrUnknownCreateTime
+			result.Skipped = append(result.Skipped, file)
+		case opts.DryRun:
+			file.Err = ErrDryRun
+			result.Skipped = append(result.Skipped, file)
+		default:
+			selected = append(selected, file)
+		}
+	}
+	if len(selected) == 0 {
+		log.Printf("No files to delete in bucket %s (%d skipped)", bucketUuid, len(result.Skipped))
+		return result, nil
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultDeleteConcurrency
+	}
+	log.Printf("Deleting %d files from bucket %s", len(selected), bucketUuid)
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range selected {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(f *DeletedFile) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			f.Err = deleteSelectedFile(bucketUuid, *f)
+		}(&selected[i])
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, f := range selected {
+		if f.Err != nil {
+			result.Failed = append(result.Failed, f)
+			errs = append(errs, f.Err)
+		} else {
+			result.Deleted = append(result.Deleted, f)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("Failed to delete %d of %d files from bucket %s", len(errs), len(selected), bucketUuid)
+		return result, err
+	}
+
+	log.Printf("Deleted %d files from bucket %s", len(result.Deleted), bucketUuid)
+	return result, nil
+}
+
+// matcher compiles the selector into a predicate over files. Files with an unknown creation
+// time pass the CreatedBefore criterion so that they can be reported as skipped.
+func (s DeleteSelector) matcher() (func(FileInfo) bool, error) {
+	var glob *regexp.Regexp
+	if s.Glob != "" {
+		expr, err := globToRegexp(strings.Trim(s.Glob, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", s.Glob, err)
+		}
+		glob, err = regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", s.Glob, err)
+		}
+	}
+	prefix := strings.TrimPrefix(s.Prefix, "/")
+	family, isFamily := strings.CutSuffix(s.ContentType, "/*")
+
+	return func(info FileInfo) bool {
+		p := remoteFilePath(info)
+		if glob != nil && !glob.MatchString(p) {
+			return false
+		}
+		if prefix != "" && !strings.HasPrefix(p, prefix) {
+			return false
+		}
+		if s.ContentType != "" {
+			contentType, _, _ := strings.Cut(info.ContentType, ";")
+			contentType = strings.TrimSpace(contentType)
+			if isFamily && !strings.HasPrefix(contentType, family+"/") {
+				return false
+			}
+			if !isFamily && !strings.EqualFold(contentType, s.ContentType) {
+				return false
+			}
+		}
+		if !s.CreatedBefore.IsZero() && !info.CreateTime.IsZero() && !info.CreateTime.Before(s.CreatedBefore) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// deleteSelectedFile deletes a file and checks the status of the API response.
+func deleteSelectedFile(bucketUuid string, f DeletedFile) error {
+	res, err := DeleteFile(bucketUuid, f.FileUUID)
+	if err != nil {
+		return &DeleteFileError{Path: f.Path, FileUUID: f.FileUUID, Err: err}
+	}
+
+	var resp APIResponse[json.RawMessage]
+	if errUnmarshal := json.Unmarshal([]byte(res), &resp); errUnmarshal != nil {
+		return &DeleteFileError{Path: f.Path, FileUUID: f.FileUUID, Err: fmt.Errorf("failed to unmarshal delete file response: %w. Raw response: %s", errUnmarshal, res)}
+	}
+	if resp.Status >= 400 {
+		return &DeleteFileError{Path: f.Path, FileUUID: f.FileUUID, Status: resp.Status, Err: errors.New(res)}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func mockDeleteTargets(bucketUUID string) {
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "old-map", "name": "app.js.map", "path": "builds/2024-01/", "contentType": "application/json", "createTime": "2024-01-10T00:00:00Z"},
+		{"fileUuid": "old-js", "name": "app.js", "path": "builds/2024-01/", "contentType": "text/javascript", "createTime": "2024-01-10T00:00:00Z"},
+		{"fileUuid": "new-map", "name": "app.js.map", "path": "builds/2025-06/", "contentType": "application/json", "createTime": "2025-06-01T00:00:00Z"},
+		{"fileUuid": "no-time", "name": "vendor.js.map", "path": "builds/legacy/", "contentType": "application/json"},
+		{"fileUuid": "logo", "name": "logo.png", "path": "assets/", "contentType": "image/png", "createTime": "2024-01-10T00:00:00Z"},
+	})
+}
+
+func TestDeleteMatching(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockDeleteTargets(bucketUUID)
+	gock.New("https://api.apillon.io").
+		Delete("/storage/buckets/" + bucketUUID + "/files/old-map").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+
+	result, err := DeleteMatching(bucketUUID, DeleteSelector{
+		Glob:          "builds/**/*.map",
+		CreatedBefore: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("DeleteMatching returned error: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0].FileUUID != "old-map" {
+		t.Errorf("deleted %+v", result.Deleted)
+	}
+	if len(result.Skipped) != 1 || !errors.Is(result.Skipped[0].Err, ErrUnknownCreateTime) {
+		t.Errorf("skipped %+v", result.Skipped)
+	}
+	if !gock.IsDone() {
+		t.Error("expected the selected file to be deleted")
+	}
+}
+
+func TestDeleteMatching_DryRun(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockDeleteTargets(bucketUUID)
+
+	result, err := DeleteMatchingWithOptions(bucketUUID, DeleteSelector{Prefix: "/builds/2024-"}, DeleteOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("DeleteMatching returned error: %v", err)
+	}
+	var uuids []string
+	for _, f := range result.Skipped {
+		if !errors.Is(f.Err, ErrDryRun) {
+			t.Errorf("skipped %s with %v, want ErrDryRun", f.FileUUID, f.Err)
+		}
+		uuids = append(uuids, f.FileUUID)
+	}
+	sort.Strings(uuids)
+	if len(result.Deleted) != 0 || len(uuids) != 2 || uuids[0] != "old-js" || uuids[1] != "old-map" {
+		t.Errorf("dry run deleted %+v and skipped %v", result.Deleted, uuids)
+	}
+}
+
+func TestDeleteMatching_PartialFailure(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockDeleteTargets(bucketUUID)
+	gock.New("https://api.apillon.io").
+		Delete("/storage/buckets/" + bucketUUID + "/files/old-map").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+	gock.New("https://api.apillon.io").
+		Delete("/storage/buckets/" + bucketUUID + "/files/new-map").
+		Reply(400).
+		JSON(map[string]any{"status": 400, "message": "FILE_NOT_DELETABLE"})
+	gock.New("https://api.apillon.io").
+		Delete("/storage/buckets/" + bucketUUID + "/files/no-time").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+
+	result, err := DeleteMatching(bucketUUID, DeleteSelector{ContentType: "application/*"})
+	var deleteErr *DeleteFileError
+	if !errors.As(err, &deleteErr) || deleteErr.FileUUID != "new-map" || deleteErr.Status != 400 {
+		t.Fatalf("DeleteMatching error = %v, want a DeleteFileError for new-map", err)
+	}
+	if len(result.Deleted) != 2 || len(result.Failed) != 1 {
+		t.Errorf("deleted %+v, failed %+v", result.Deleted, result.Failed)
+	}
+}
+
+func TestDeleteMatching_EmptySelector(t *testing.T) {
+	if _, err := DeleteMatching("test-bucket-uuid", DeleteSelector{}); !errors.Is(err, ErrEmptySelector) {
+		t.Errorf("DeleteMatching error = %v, want ErrEmptySelector", err)
+	}
+}
+
+func TestDeleteMatching_InvalidGlob(t *testing.T) {
+	for _, glob := range []string{"[]", "[!]", "[[:nope:]]x"} {
+		_, err := DeleteMatching("test-bucket-uuid", DeleteSelector{Glob: glob})
+		if err == nil || !strings.Contains(err.Error(), "invalid glob") {
+			t.Errorf("DeleteMatching(%q) error = %v, want an invalid glob error", glob, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"strings"
+
+	"github.com/LeonardoRyuta/apillon-storage/requests"
+)
+
+// Directory is a directory in a bucket, as returned when creating one.
+type Directory struct {
+	Timestamps
+	DirectoryUUID string `json:"directoryUuid"`                 // Unique identifier of the directory
+	Name          string `json:"name"`                          // Name of the directory
+	Description   string `json:"description,omitempty"`         // Description of the directory
+	ParentUUID    string `json:"parentDirectoryUuid,omitempty"` // UUID of the parent directory, empty at the bucket root
+	CID           string `json:"CID,omitempty"`                 // Content Identifier (CID) of the directory once on IPFS
+}
+
+// DirectoryResponse represents a response containing a single directory.
+type DirectoryResponse = APIResponse[Directory]
+
+// createDirectoryRequest is the body sent to create a directory.
+type createDirectoryRequest struct {
+	Name       string `json:"name"`
+	ParentUUID string `json:"parentDirectoryUuid,omitempty"`
+}
+
+// ListDirectoryByUUID returns every file and directory directly inside a bucket directory,
+// the bucket root if directoryUuid is empty, sorted by name.
+func ListDirectoryByUUID(bucketUuid string, directoryUuid string) ([]ContentItem, error) {
+	if bucketUuid == "" {
+		return nil, fmt.Errorf("bucket uuid is required")
+	}
+	return listDirectory(bucketUuid, directoryUuid)
+}
+
+// ListDirectoryByPath returns every file and directory directly inside the bucket directory at
+// the slash-separated dirPath, the bucket root if empty, sorted by name.
+// Returns an error wrapping fs.ErrNotExist if the directory does not exist.
+func ListDirectoryByPath(bucketUuid string, dirPath string) ([]ContentItem, error) {
+	directoryUuid, err := ResolveDirectoryPath(bucketUuid, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return listDirectory(bucketUuid, directoryUuid)
+}
+
+// ResolveDirectoryPath looks up the UUID of the directory at the slash-separated dirPath, e.g.
+// "assets/img", by listing each directory along the path. The bucket root resolves to "".
+// Returns an error wrapping fs.ErrNotExist if a directory along the path does not exist.
+func ResolveDirectoryPath(bucketUuid string, dirPath string) (string, error) {
+	if bucketUuid == "" {
+		return "", fmt.Errorf("bucket uuid is required")
+	}
+
+	directoryUuid := ""
+	for i, name := range splitPath(dirPath) {
+		items, err := listDirectory(bucketUuid, directoryUuid)
+		if err != nil {
+			return "", err
+		}
+		item, ok := findContentItem(items, name)
+		if !ok {
+			return "", fmt.Errorf("directory %q in bucket %s: %w", strings.Join(splitPath(dirPath)[:i+1], "/"), bucketUuid, fs.ErrNotExist)
+		}
+		if !item.IsDir() {
+			return "", fmt.Errorf("%q in bucket %s: %w", strings.Join(splitPath(dirPath)[:i+1], "/"), bucketUuid, errNotDir)
+		}
+		directoryUuid = item.UUID
+	}
+	return directoryUuid, nil
+}
+
+// CreateDirectory creates a directory named name inside the directory parentDirectoryUuid,
+// or at the bucket root if it is empty.
+// Returns the created directory, or an error if the request fails or the API returns an error.
+func CreateDirectory(bucketUuid string, name string, parentDirectoryUuid string) (Directory, error) {
+	if bucketUuid == "" {
+		return Directory{}, fmt.Errorf("bucket uuid is required")
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return Directory{}, fmt.Errorf("invalid directory name %q", name)
+	}
+
+	bodyBytes, err := json.Marshal(createDirectoryRequest{Name: name, ParentUUID: parentDirectoryUuid})
+	if err != nil {
+		log.Printf("Failed to marshal create directory request for bucket %s: %v", bucketUuid, err)
+		return Directory{}, err
+	}
+
+	path := "/storage/buckets/" + bucketUuid + "/directories"
+	res, err := requests.PostReq(path, strings.NewReader(string(bodyBytes)))
+	if err != nil {
+		log.Printf("Failed to create directory %s in bucket %s: %v", name, bucketUuid, err)
+		return Directory{}, err
+	}
+
+	var resp DirectoryResponse
+	if errUnmarshal := json.Unmarshal([]byte(res), &resp); errUnmarshal != nil {
+		log.Printf("Failed to unmarshal JSON response from create directory %s in bucket %s: %v. Raw response: %s", name, bucketUuid, errUnmarshal, res)
+		return Directory{}, fmt.Errorf("failed to unmarshal create directory response: %w. Raw response: %s", errUnmarshal, res)
+	}
+	if resp.Status >= 400 {
+		return Directory{}, fmt.Errorf("create directory %s returned status %d: %s", name, resp.Status, res)
+	}
+	if resp.Data.ParentUUID == "" {
+		resp.Data.ParentUUID = parentDirectoryUuid
+	}
+
+	log.Printf("Directory %s created successfully in bucket %s: %s", resp.Data.DirectoryUUID, bucketUuid, res)
+	return resp.Data, nil
+}
+
+// CreateDirectoryPath creates the directory at the slash-separated dirPath together with any
+// missing parents, like os.MkdirAll. Existing directories along the path are reused.
+// Returns the directory at dirPath, or an error if a path element is a file or a request fails.
+func CreateDirectoryPath(bucketUuid string, dirPath string) (Directory, error) {
+	if bucketUuid == "" {
+		return Directory{}, fmt.Errorf("bucket uuid is required")
+	}
+	names := splitPath(dirPath)
+	if len(names) == 0 {
+		return Directory{}, fmt.Errorf("directory path is required")
+	}
+
+	var dir Directory
+	for i, name := range names {
+		items, err := listDirectory(bucketUuid, dir.DirectoryUUID)
+		if err != nil {
+			return Directory{}, err
+		}
+		if item, ok := findContentItem(items, name); ok {
+			if !item.IsDir() {
+				return Directory{}, fmt.Errorf("%q in bucket %s: %w", strings.Join(names[:i+1], "/"), bucketUuid, errNotDir)
+			}
+			dir = Directory{Timestamps: item.Timestamps, DirectoryUUID: item.UUID, Name: item.Name, ParentUUID: item.ParentUUID, CID: item.CID}
+			continue
+		}
+		if dir, err = CreateDirectory(bucketUuid, name, dir.DirectoryUUID); err != nil {
+			return Directory{}, err
+		}
+	}
+	return dir, nil
+}
+
+// DeleteDirectoryPath deletes the directory at the slash-separated dirPath together with all the
+// files and directories inside it. Deleting the bucket root is refused; use DeleteBucket instead.
+// Returns an error wrapping fs.ErrNotExist if the directory does not exist.
+func DeleteDirectoryPath(bucketUuid string, dirPath string) (DeleteDirectoryResponse, error) {
+	if len(splitPath(dirPath)) == 0 {
+		return DeleteDirectoryResponse{}, fmt.Errorf("refusing to delete the bucket root")
+	}
+	directoryUuid, err := ResolveDirectoryPath(bucketUuid, dirPath)
+	if err != nil {
+		return DeleteDirectoryResponse{}, err
+	}
+	return DeleteDirectory(bucketUuid, directoryUuid)
+}
+
+// findContentItem returns the item called name.
+func findContentItem(items []ContentItem, name string) (ContentItem, bool) {
+	for _, item := range items {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return ContentItem{}, false
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestResolveDirectoryPath(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockContentTree(bucketUUID)
+
+	uuid, err := ResolveDirectoryPath(bucketUUID, "/docs/img/")
+	if err != nil || uuid != "dir-img" {
+		t.Errorf("ResolveDirectoryPath = %q, %v, want dir-img", uuid, err)
+	}
+}
+
+func TestResolveDirectoryPath_Errors(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	for range 2 {
+		mockContent(bucketUUID, "", []map[string]any{
+			{"type": 2, "uuid": "file-a", "name": "a.txt"},
+			{"type": 1, "uuid": "dir-docs", "name": "docs"},
+		})
+	}
+
+	if _, err := ResolveDirectoryPath(bucketUUID, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing directory error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := ResolveDirectoryPath(bucketUUID, "a.txt/img"); !errors.Is(err, errNotDir) {
+		t.Errorf("file in path error = %v, want errNotDir", err)
+	}
+}
+
+func TestListDirectoryByPath(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockContentTree(bucketUUID)
+
+	items, err := ListDirectoryByPath(bucketUUID, "docs")
+	if err != nil {
+		t.Fatalf("ListDirectoryByPath returned error: %v", err)
+	}
+	if len(items) != 2 || items[0].Name != "b.md" || !items[1].IsDir() {
+		t.Errorf("unexpected items %+v", items)
+	}
+}
+
+func TestCreateDirectoryPath(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockContent(bucketUUID, "dir-assets", []map[string]any{})
+	mockContent(bucketUUID, "", []map[string]any{
+		{"type": 1, "uuid": "dir-assets", "name": "assets"},
+	})
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/directories").
+		MatchType("json").
+		JSON(map[string]string{"name": "img", "parentDirectoryUuid": "dir-assets"}).
+		Reply(201).
+		JSON(map[string]any{"status": 201, "data": map[string]any{"directoryUuid": "dir-img", "name": "img"}})
+
+	dir, err := CreateDirectoryPath(bucketUUID, "assets/img")
+	if err != nil {
+		t.Fatalf("CreateDirectoryPath returned error: %v", err)
+	}
+	if dir.DirectoryUUID != "dir-img" || dir.ParentUUID != "dir-assets" {
+		t.Errorf("unexpected directory %+v", dir)
+	}
+	if !gock.IsDone() {
+		t.Error("expected only the missing directory to be created")
+	}
+}
+
+func TestDeleteDirectoryPath(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockContentTree(bucketUUID)
+	gock.New("https://api.apillon.io").
+		Delete("/storage/buckets/" + bucketUUID + "/directories/dir-img").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+
+	if _, err := DeleteDirectoryPath(bucketUUID, "docs/img"); err != nil {
+		t.Fatalf("DeleteDirectoryPath returned error: %v", err)
+	}
+	if _, err := DeleteDirectoryPath(bucketUUID, "/"); err == nil {
+		t.Error("expected deleting the bucket root to be refused")
+	}
+}
@@ -0,0 +1,474 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+)
+
+// fileLink returns a link to the content of a stored file, generating an IPFS link when
+// the file details do not include one yet.
+func fileLink(info FileInfo) (string, error) {
+	if info.Link != "" {
+		return info.Link, nil
+	}
+	if info.CID == "" {
+		return "", fmt.Errorf("file %s has no link or CID yet", info.FileUUID)
+	}
+	return GetOrGenerateIPFSLink(info.CID)
+}
+
+// openLink starts downloading the content behind link. The caller must close the returned body.
+// Reading the body counts towards the limit set with SetBandwidthLimit.
+func openLink(link string) (io.ReadCloser, error) {
+	return openLinkAt(link, 0)
+}
+
+// openLinkAt starts downloading the content behind link from offset, using a Range request when
+// offset is positive. If the server ignores the range, the skipped bytes are read and discarded.
+// The caller must close the returned body.
+func openLinkAt(link string, offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		log.Printf("Failed to create request for %s: %v", link, err)
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Failed to download %s: %v", link, err)
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		log.Printf("Failed to download %s, status code: %d, response: %s", link, resp.StatusCode, string(bodyBytes))
+		return nil, &downloadStatusError{Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	body := throttleBody(resp.Body)
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(io.Discard, body, offset); err != nil {
+			body.Close()
+			return nil, fmt.Errorf("failed to skip to offset %d of %s: %w", offset, link, err)
+		}
+	}
+	return body, nil
+}
+
+// downloadStatusError is returned when a download link answers with a non-2xx status.
+type downloadStatusError struct {
+	Status int    // HTTP status code of the response
+	Body   string // Response body
+}
+
+func (e *downloadStatusError) Error() string {
+	return fmt.Sprintf("download failed with status code %d: %s", e.Status, e.Body)
+}
+
+// retryableDownload reports whether a failed transfer is worth retrying: network and transfer errors,
+// server errors and rate limiting are, other client errors such as an expired token or 404 are not.
+func retryableDownload(err error) bool {
+	var statusErr *downloadStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status >= 500 || statusErr.Status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// downloadLink streams the content behind link into w.
+func downloadLink(link string, w io.Writer) error {
+	body, err := openLink(link)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Failed to read download from %s: %v", link, err)
+		return err
+	}
+	return nil
+}
+
+// downloadToPath downloads the content behind link into the file at path, replacing it atomically.
+func downloadToPath(link string, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".download-*")
+	if err != nil {
+		return err
+	}
+	if err := downloadLink(link, tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// DefaultDownloadConcurrency is the number of files DownloadDirectory downloads at the same time.
+const DefaultDownloadConcurrency = 4
+
+// DefaultDownloadRetries is how many times a failed transfer is resumed with a Range request.
+const DefaultDownloadRetries = 3
+
+// downloadRetryDelay is the wait before the first retry of a failed transfer; it doubles with
+// each further retry up to maxDownloadRetryDelay.
+var downloadRetryDelay = 500 * time.Millisecond
+
+// maxDownloadRetryDelay caps the wait between retries of a failed transfer.
+const maxDownloadRetryDelay = 10 * time.Second
+
+// ErrSizeMismatch is returned when downloaded content differs in size from the file reported by Apillon.
+var ErrSizeMismatch = errors.New("size mismatch")
+
+// DownloadOptions configures DownloadDirectoryWithOptions.
+type DownloadOptions struct {
+	Concurrency int  // Files downloaded at the same time; defaults to DefaultDownloadConcurrency
+	Retries     int  // Range-resumed attempts after a failed transfer; defaults to DefaultDownloadRetries, negative disables
+	SkipVerify  bool // Skip comparing the CID of the downloaded content with the CID reported by Apillon
+}
+
+// DownloadedFile describes the download of a single file.
+type DownloadedFile struct {
+	Path      string // Path of the file in the bucket
+	LocalPath string // Path of the downloaded file on disk
+	FileUUID  string // Unique identifier for the file
+	Size      int64  // Size of the downloaded file in bytes
+	Resumed   bool   // Whether the download continued a partial download from an earlier run
+	Err       error  // Why the file was not downloaded, nil on success
+}
+
+// DownloadResult describes a directory download.
+type DownloadResult struct {
+	BucketUUID string           // UUID of the bucket the files were downloaded from
+	Files      []DownloadedFile // One entry per file below the remote path, in listing order
+	Duration   time.Duration    // Total time of the download
+}
+
+// Failed returns the files that were not downloaded.
+func (r DownloadResult) Failed() []DownloadedFile {
+	var failed []DownloadedFile
+	for _, f := range r.Files {
+		if f.Err != nil {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
+// DownloadFile streams the content of a file in a bucket into w. The link is taken from GetFileDetails,
+// or generated from the file's CID. A transfer that fails midway is resumed with Range requests.
+// Once complete, the size and CID of the content are checked against the file details.
+// Returns the file details, and an error wrapping ErrSizeMismatch or ErrCIDMismatch if verification fails.
+func DownloadFile(bucketUuid string, fileUuid string, w io.Writer) (FileInfo, error) {
+	details, err := GetFileDetails(bucketUuid, fileUuid)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info := details.Data
+
+	hasher := newCIDHasher()
+	written, err := fetchFile(info, io.MultiWriter(w, hasher), 0, DefaultDownloadRetries)
+	if err != nil {
+		hasher.abort(err)
+		log.Printf("Failed to download file %s from bucket %s: %v", fileUuid, bucketUuid, err)
+		return info, err
+	}
+	if err := verifyDownload(info, written, hasher); err != nil {
+		log.Printf("Downloaded file %s from bucket %s failed verification: %v", fileUuid, bucketUuid, err)
+		return info, err
+	}
+
+	log.Printf("Downloaded file %s from bucket %s (%d bytes)", fileUuid, bucketUuid, written)
+	return info, nil
+}
+
+// DownloadDirectory downloads every file below remotePath in a bucket into localDir, keeping the
+// directory structure, with the default DownloadOptions.
+func DownloadDirectory(bucketUuid string, remotePath string, localDir string) (DownloadResult, error) {
+	return DownloadDirectoryWithOptions(bucketUuid, remotePath, localDir, DownloadOptions{})
+}
+
+// DownloadDirectoryWithOptions downloads every file below remotePath (the whole bucket if empty) into
+// localDir, opts.Concurrency files at a time. Each file is written to a ".part" file next to its target
+// and renamed once complete and verified; a ".part" file left by an interrupted run is resumed with a
+// Range request. Files that fail do not stop the others.
+// Returns a DownloadResult with one entry per file, and the joined errors of the failed files.
+func DownloadDirectoryWithOptions(bucketUuid string, remotePath string, localDir string, opts DownloadOptions) (DownloadResult, error) {
+	if bucketUuid == "" {
+		return DownloadResult{}, fmt.Errorf("bucket uuid is required")
+	}
+	if localDir == "" {
+		return DownloadResult{}, fmt.Errorf("local directory is required")
+	}
+
+	start := time.Now()
+	remoteFiles, err := listBucketFiles(bucketUuid)
+	if err != nil {
+		return DownloadResult{}, err
+	}
+
+	prefix := strings.Trim(remotePath, "/")
+	var infos []FileInfo
+	var results []DownloadedFile
+	for _, info := range remoteFiles {
+		p := remoteFilePath(info)
+		rel, ok := underPrefix(prefix, p)
+		if !ok {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			log.Printf("Skipping file %s with unsafe path", p)
+			continue
+		}
+		infos = append(infos, info)
+		results = append(results, DownloadedFile{Path: p, LocalPath: filepath.Join(localDir, filepath.FromSlash(rel)), FileUUID: info.FileUUID})
+	}
+	if len(infos) == 0 {
+		return DownloadResult{}, fmt.Errorf("no files below %q in bucket %s", remotePath, bucketUuid)
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultDownloadConcurrency
+	}
+	log.Printf("Downloading %d files from bucket %s to %s", len(infos), bucketUuid, localDir)
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range infos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i].Size, results[i].Resumed, results[i].Err = downloadToFile(infos[i], results[i].LocalPath, opts)
+		}(i)
+	}
+	wg.Wait()
+
+	result := DownloadResult{BucketUUID: bucketUuid, Files: results, Duration: time.Since(start)}
+	var errs []error
+	for _, r := range result.Failed() {
+		errs = append(errs, fmt.Errorf("failed to download %s: %w", r.Path, r.Err))
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("Failed to download %d of %d files from bucket %s", len(errs), len(results), bucketUuid)
+		return result, err
+	}
+
+	log.Printf("Downloaded %d files from bucket %s in %s", len(results), bucketUuid, result.Duration)
+	return result, nil
+}
+
+// downloadToFile downloads a file to localPath through a ".part" file, resuming it if it exists.
+// Returns the size of the file and whether an earlier partial download was resumed.
+func downloadToFile(info FileInfo, localPath string, opts DownloadOptions) (int64, bool, error) {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return 0, false, err
+	}
+	part := localPath + ".part"
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false, err
+	}
+	if info.Size > 0 && offset > info.Size {
+		// The partial file belongs to different content
+		if err := f.Truncate(0); err != nil {
+			return 0, false, err
+		}
+		offset, _ = f.Seek(0, io.SeekStart)
+	}
+
+	var w io.Writer = f
+	var hasher *cidHasher
+	if !opts.SkipVerify {
+		hasher = newCIDHasher()
+		w = io.MultiWriter(f, hasher)
+		if offset > 0 {
+			// Feed the resumed bytes to the hasher so the whole file is verified
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return 0, false, err
+			}
+			if _, err := io.CopyN(hasher, f, offset); err != nil {
+				hasher.abort(err)
+				return 0, false, err
+			}
+		}
+	}
+
+	retries := opts.Retries
+	if retries == 0 {
+		retries = DefaultDownloadRetries
+	}
+
+	written := offset
+	if info.Size == 0 || offset < info.Size {
+		written, err = fetchFile(info, w, offset, max(retries, 0))
+		if err != nil {
+			if hasher != nil {
+				hasher.abort(err)
+			}
+			return written, offset > 0, err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return written, offset > 0, err
+	}
+
+	if err := verifyDownload(info, written, hasher); err != nil {
+		os.Remove(part)
+		return written, offset > 0, err
+	}
+	if err := os.Rename(part, localPath); err != nil {
+		return written, offset > 0, err
+	}
+	return written, offset > 0, nil
+}
+
+// fetchFile streams the content of a file into w starting at offset. A transfer that fails with a
+// network error, a server error or rate limiting is resumed from the last written byte with a Range
+// request, up to retries times with exponential backoff; other client errors fail straight away.
+// Returns the offset reached, which is the total size once the download is complete.
+func fetchFile(info FileInfo, w io.Writer, offset int64, retries int) (int64, error) {
+	link, err := fileLink(info)
+	if err != nil {
+		return offset, err
+	}
+
+	written := offset
+	delay := downloadRetryDelay
+	for attempt := 0; ; attempt++ {
+		body, err := openLinkAt(link, written)
+		if err == nil {
+			var n int64
+			n, err = io.Copy(w, body)
+			body.Close()
+			written += n
+			if err == nil {
+				return written, nil
+			}
+		}
+		if attempt >= retries || !retryableDownload(err) {
+			return written, err
+		}
+		log.Printf("Resuming download of file %s at byte %d in %s after error: %v", info.FileUUID, written, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, maxDownloadRetryDelay)
+	}
+}
+
+// verifyDownload checks the size of a download, and its CID when hasher is not nil and
+// Apillon reported a CID for the file.
+func verifyDownload(info FileInfo, size int64, hasher *cidHasher) error {
+	if info.Size > 0 && size != info.Size {
+		if hasher != nil {
+			hasher.abort(ErrSizeMismatch)
+		}
+		return fmt.Errorf("%w for file %s: downloaded %d bytes, expected %d", ErrSizeMismatch, info.FileUUID, size, info.Size)
+	}
+	if hasher == nil {
+		return nil
+	}
+
+	v0, v1, err := hasher.sum()
+	if err != nil {
+		return err
+	}
+	if info.CID == "" {
+		return nil
+	}
+	remote, err := cid.Parse(info.CID)
+	if err != nil {
+		return fmt.Errorf("failed to parse CID of file %s: %w", info.FileUUID, err)
+	}
+	if !cidMatches(remote, v0, v1) {
+		return fmt.Errorf("%w for file %s: remote %s, local %s", ErrCIDMismatch, info.FileUUID, info.CID, v0)
+	}
+	return nil
+}
+
+// cidHasher computes the CIDv0 and CIDv1 of the content written to it, in constant memory.
+type cidHasher struct {
+	w0, w1 *io.PipeWriter
+	out0   chan cidResult
+	out1   chan cidResult
+}
+
+type cidResult struct {
+	cid cid.Cid
+	err error
+}
+
+func newCIDHasher() *cidHasher {
+	h := &cidHasher{out0: make(chan cidResult, 1), out1: make(chan cidResult, 1)}
+	h.w0 = startCID(cid.V0(), h.out0)
+	h.w1 = startCID(cid.V1(), h.out1)
+	return h
+}
+
+// startCID computes a CID with opts from the data written to the returned pipe.
+func startCID(opts cid.Options, out chan<- cidResult) *io.PipeWriter {
+	pr, pw := io.Pipe()
+	go func() {
+		c, err := cid.FromReader(pr, opts)
+		pr.CloseWithError(err) // Unblocks writers if hashing failed
+		out <- cidResult{c, err}
+	}()
+	return pw
+}
+
+func (h *cidHasher) Write(p []byte) (int, error) {
+	if _, err := h.w0.Write(p); err != nil {
+		return 0, err
+	}
+	return h.w1.Write(p)
+}
+
+// sum finishes hashing and returns the CIDv0 and CIDv1 of the written content.
+func (h *cidHasher) sum() (cid.Cid, cid.Cid, error) {
+	h.w0.Close()
+	h.w1.Close()
+	r0, r1 := <-h.out0, <-h.out1
+	return r0.cid, r1.cid, errors.Join(r0.err, r1.err)
+}
+
+// abort stops hashing after a failed download.
+func (h *cidHasher) abort(err error) {
+	h.w0.CloseWithError(err)
+	h.w1.CloseWithError(err)
+	<-h.out0
+	<-h.out1
+}
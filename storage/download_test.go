@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+// testGateway serves files by URL path, honouring Range requests, and lets requests to it
+// through gock while the API stays mocked. ranges receives the Range header of every request.
+func testGateway(t *testing.T, files map[string]string) (gateway *httptest.Server, ranges func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []string
+	gateway = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("Range"))
+		mu.Unlock()
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(content))
+	}))
+	t.Cleanup(gateway.Close)
+
+	gock.EnableNetworking()
+	gock.NetworkingFilter(func(req *http.Request) bool { return req.URL.Host == strings.TrimPrefix(gateway.URL, "http://") })
+	t.Cleanup(gock.DisableNetworkingFilters)
+	t.Cleanup(gock.DisableNetworking)
+
+	return gateway, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func testCID(t *testing.T, content string) string {
+	t.Helper()
+	c, err := cid.FromBytes([]byte(content), cid.V0())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.String()
+}
+
+func TestDownloadFile(t *testing.T) {
+	defer gock.Off()
+
+	content := "hello from the bucket"
+	gateway, _ := testGateway(t, map[string]string{"/a": content})
+
+	bucketUUID := "test-bucket-uuid"
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/" + bucketUUID + "/files/file-a").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{
+			"fileUuid": "file-a", "name": "a.txt", "size": len(content), "CID": testCID(t, content), "link": gateway.URL + "/a",
+		}})
+
+	var buf bytes.Buffer
+	info, err := DownloadFile(bucketUUID, "file-a", &buf)
+	if err != nil {
+		t.Fatalf("DownloadFile returned error: %v", err)
+	}
+	if buf.String() != content || info.Name != "a.txt" {
+		t.Errorf("downloaded %q for %+v", buf.String(), info)
+	}
+}
+
+func TestDownloadFile_CIDMismatch(t *testing.T) {
+	defer gock.Off()
+
+	gateway, _ := testGateway(t, map[string]string{"/a": "tampered"})
+
+	bucketUUID := "test-bucket-uuid"
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/" + bucketUUID + "/files/file-a").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{
+			"fileUuid": "file-a", "name": "a.txt", "size": 8, "CID": testCID(t, "original"), "link": gateway.URL + "/a",
+		}})
+
+	if _, err := DownloadFile(bucketUUID, "file-a", &bytes.Buffer{}); !errors.Is(err, ErrCIDMismatch) {
+		t.Errorf("DownloadFile error = %v, want ErrCIDMismatch", err)
+	}
+}
+
+func TestDownloadDirectory(t *testing.T) {
+	defer gock.Off()
+
+	files := map[string]string{
+		"/a": "top level file",
+		"/b": "a document in the docs directory",
+		"/c": "an image in a nested directory",
+	}
+	gateway, ranges := testGateway(t, files)
+
+	bucketUUID := "test-bucket-uuid"
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "file-a", "name": "a.txt", "size": len(files["/a"]), "CID": testCID(t, files["/a"]), "link": gateway.URL + "/a"},
+		{"fileUuid": "file-b", "name": "b.md", "path": "docs/", "size": len(files["/b"]), "CID": testCID(t, files["/b"]), "link": gateway.URL + "/b"},
+		{"fileUuid": "file-c", "name": "c.png", "path": "docs/img/", "size": len(files["/c"]), "CID": testCID(t, files["/c"]), "link": gateway.URL + "/c"},
+	})
+
+	dir := t.TempDir()
+	// A partial download of b.md left by an interrupted run
+	writeTestFiles(t, dir, map[string]string{"b.md.part": files["/b"][:10]})
+
+	result, err := DownloadDirectory(bucketUUID, "/docs/", dir)
+	if err != nil {
+		t.Fatalf("DownloadDirectory returned error: %v", err)
+	}
+	if len(result.Files) != 2 {
+		t.Fatalf("downloaded %d files, want 2: %+v", len(result.Files), result.Files)
+	}
+
+	for rel, key := range map[string]string{"b.md": "/b", "img/c.png": "/c"} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil || string(data) != files[key] {
+			t.Errorf("%s = %q, %v", rel, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); !os.IsNotExist(err) {
+		t.Error("downloaded a file outside the remote path")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.md.part")); !os.IsNotExist(err) {
+		t.Error("partial file was not renamed")
+	}
+
+	for _, f := range result.Files {
+		if f.Resumed != (f.FileUUID == "file-b") {
+			t.Errorf("file %s resumed = %v", f.FileUUID, f.Resumed)
+		}
+	}
+	var resumed bool
+	for _, r := range ranges() {
+		resumed = resumed || r == "bytes=10-"
+	}
+	if !resumed {
+		t.Errorf("expected a Range request resuming b.md, got %q", ranges())
+	}
+}
+
+func TestDownloadDirectory_SizeMismatchRemovesPartial(t *testing.T) {
+	defer gock.Off()
+
+	gateway, _ := testGateway(t, map[string]string{"/a": "short"})
+
+	bucketUUID := "test-bucket-uuid"
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "file-a", "name": "a.txt", "size": 100, "link": gateway.URL + "/a"},
+	})
+
+	dir := t.TempDir()
+	result, err := DownloadDirectoryWithOptions(bucketUUID, "", dir, DownloadOptions{Retries: -1})
+	if !errors.Is(err, ErrSizeMismatch) {
+		t.Fatalf("DownloadDirectory error = %v, want ErrSizeMismatch", err)
+	}
+	if len(result.Failed()) != 1 {
+		t.Errorf("expected one failed file, got %+v", result.Files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt.part")); !os.IsNotExist(err) {
+		t.Error("partial file was kept after verification failed")
+	}
+}
+
+func TestFetchFile_Retries(t *testing.T) {
+	defer func(d time.Duration) { downloadRetryDelay = d }(downloadRetryDelay)
+	downloadRetryDelay = time.Millisecond
+
+	tests := []struct {
+		name     string
+		statuses []int // Status of each response; 200 serves the content
+		wantErr  bool
+		requests int
+	}{
+		{"ServerErrorRetried", []int{503, 429, 200}, false, 3},
+		{"NotFoundFailsFast", []int{404, 200}, true, 1},
+		{"ExpiredTokenFailsFast", []int{403, 200}, true, 1},
+		{"GivesUpAfterRetries", []int{500, 500, 500, 500, 200}, true, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				status := tt.statuses[min(requests, len(tt.statuses)-1)]
+				requests++
+				mu.Unlock()
+				if status != http.StatusOK {
+					http.Error(w, http.StatusText(status), status)
+					return
+				}
+				w.Write([]byte("content"))
+			}))
+			defer server.Close()
+
+			var buf bytes.Buffer
+			_, err := fetchFile(FileInfo{FileUUID: "file-a", Link: server.URL + "/a"}, &buf, 0, 3)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("fetchFile error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requests != tt.requests {
+				t.Errorf("made %d requests, want %d", requests, tt.requests)
+			}
+			if !tt.wantErr && buf.String() != "content" {
+				t.Errorf("downloaded %q", buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// EncryptionAlgorithm is the algorithm recorded in the header of encrypted files.
+const EncryptionAlgorithm = "AES-256-GCM"
+
+// DefaultEncryptionChunkSize is the amount of plaintext sealed in each encrypted chunk.
+const DefaultEncryptionChunkSize = 64 * 1024
+
+// encryptionMagic starts every encrypted file.
+var encryptionMagic = []byte("APLNENC\x01")
+
+// ErrNotEncrypted is returned when decrypting content that does not start with an encryption header.
+var ErrNotEncrypted = errors.New("content is not encrypted")
+
+// encryptionNoncePrefixSize is the size of the random part of each chunk nonce.
+const encryptionNoncePrefixSize = 7
+
+// KeyProvider supplies the AES-256 keys used for client-side encryption.
+type KeyProvider interface {
+	// CurrentKey returns the ID and 32-byte key used to encrypt new files.
+	CurrentKey() (keyID string, key []byte, err error)
+	// Key returns the key with the given ID, used to decrypt files.
+	Key(keyID string) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider backed by a fixed set of keys.
+type StaticKeyProvider struct {
+	CurrentKeyID string            // ID of the key used for encryption
+	Keys         map[string][]byte // Keys by ID, each 32 bytes long
+}
+
+// NewStaticKeyProvider returns a KeyProvider with a single key.
+func NewStaticKeyProvider(keyID string, key []byte) *StaticKeyProvider {
+	return &StaticKeyProvider{CurrentKeyID: keyID, Keys: map[string][]byte{keyID: key}}
+}
+
+// CurrentKey returns the key identified by CurrentKeyID.
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	key, err := p.Key(p.CurrentKeyID)
+	return p.CurrentKeyID, key, err
+}
+
+// Key returns the key with the given ID.
+func (p *StaticKeyProvider) Key(keyID string) ([]byte, error) {
+	key, ok := p.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", keyID)
+	}
+	return key, nil
+}
+
+// EncryptionHeader is the metadata stored in front of encrypted content. It is not secret,
+// but it is authenticated together with every chunk.
+type EncryptionHeader struct {
+	Algorithm   string `json:"alg"`                   // Always EncryptionAlgorithm
+	KeyID       string `json:"keyId"`                 // ID of the key used for encryption
+	ChunkSize   int    `json:"chunkSize"`             // Plaintext bytes per chunk
+	NoncePrefix []byte `json:"noncePrefix"`           // Random per-file nonce prefix
+	ContentType string `json:"contentType,omitempty"` // Content type of the plaintext
+}
+
+// EncryptStream encrypts src into dst with AES-256-GCM using the current key of kp.
+// The plaintext is sealed in chunks so content of any size is processed in constant memory.
+// contentType is recorded in the header so it can be restored after decryption.
+func EncryptStream(dst io.Writer, src io.Reader, kp KeyProvider, contentType string) error {
+	keyID, key, err := kp.CurrentKey()
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	header := EncryptionHeader{
+		Algorithm:   EncryptionAlgorithm,
+		KeyID:       keyID,
+		ChunkSize:   DefaultEncryptionChunkSize,
+		NoncePrefix: make([]byte, encryptionNoncePrefixSize),
+		ContentType: contentType,
+	}
+	if _, err := rand.Read(header.NoncePrefix); err != nil {
+		return err
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	prefix := append(append([]byte{}, encryptionMagic...), binary.BigEndian.AppendUint16(nil, uint16(len(headerBytes)))...)
+	prefix = append(prefix, headerBytes...)
+	if _, err := dst.Write(prefix); err != nil {
+		return err
+	}
+
+	buf := make([]byte, header.ChunkSize)
+	next := make([]byte, 1)
+	var pending []byte
+	for counter := uint32(0); ; counter++ {
+		// Keep one byte of lookahead so the final chunk can be marked as such
+		n, err := io.ReadFull(src, buf[len(pending):])
+		n += copy(buf, pending)
+		pending = nil
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		last := err != nil
+		if !last {
+			m, errNext := io.ReadFull(src, next)
+			if errNext != nil && !errors.Is(errNext, io.EOF) {
+				return errNext
+			}
+			if m == 0 {
+				last = true
+			} else {
+				pending = next[:1]
+			}
+		}
+
+		sealed := aead.Seal(nil, chunkNonce(header.NoncePrefix, counter, last), buf[:n], prefix)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		if counter == ^uint32(0) {
+			return fmt.Errorf("content too large to encrypt")
+		}
+	}
+}
+
+// NewDecryptingReader returns a reader that decrypts content produced by EncryptStream, along
+// with its header. Each chunk is authenticated before it is returned; truncated or modified content
+// makes Read fail. Returns ErrNotEncrypted if src does not start with an encryption header.
+func NewDecryptingReader(src io.Reader, kp KeyProvider) (io.Reader, EncryptionHeader, error) {
+	r := bufio.NewReader(src)
+
+	magic := make([]byte, len(encryptionMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, encryptionMagic) {
+		return nil, EncryptionHeader{}, ErrNotEncrypted
+	}
+	var size uint16
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, EncryptionHeader{}, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	headerBytes := make([]byte, size)
+	if _, err := io.ReadFull(r, headerBytes); err != nil {
+		return nil, EncryptionHeader{}, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+
+	var header EncryptionHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, EncryptionHeader{}, fmt.Errorf("failed to parse encryption header: %w", err)
+	}
+	if header.Algorithm != EncryptionAlgorithm {
+		return nil, header, fmt.Errorf("unsupported encryption algorithm %q", header.Algorithm)
+	}
+	if header.ChunkSize <= 0 || header.ChunkSize > 16*1024*1024 || len(header.NoncePrefix) != encryptionNoncePrefixSize {
+		return nil, header, fmt.Errorf("invalid encryption header")
+	}
+
+	key, err := kp.Key(header.KeyID)
+	if err != nil {
+		return nil, header, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, header, err
+	}
+
+	aad := append(append([]byte{}, encryptionMagic...), binary.BigEndian.AppendUint16(nil, size)...)
+	aad = append(aad, headerBytes...)
+	return &decryptingReader{
+		src:    r,
+		aead:   aead,
+		header: header,
+		aad:    aad,
+		chunk:  make([]byte, header.ChunkSize+aead.Overhead()),
+	}, header, nil
+}
+
+type decryptingReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  EncryptionHeader
+	aad     []byte
+	chunk   []byte
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// nextChunk reads and authenticates the next chunk of ciphertext.
+func (d *decryptingReader) nextChunk() error {
+	n, err := io.ReadFull(d.src, d.chunk)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if n < d.aead.Overhead() {
+		return fmt.Errorf("encrypted content is truncated")
+	}
+
+	last := err != nil
+	if !last {
+		if _, errPeek := d.src.Peek(1); errPeek != nil {
+			last = true
+		}
+	}
+
+	plain, errOpen := d.aead.Open(d.chunk[:0], chunkNonce(d.header.NoncePrefix, d.counter, last), d.chunk[:n], d.aad)
+	if errOpen != nil {
+		return fmt.Errorf("failed to decrypt chunk %d: %w", d.counter, errOpen)
+	}
+	d.plain = plain
+	d.counter++
+	d.done = last
+	return nil
+}
+
+// DownloadDecrypted downloads a file from the Link of its FileInfo (or a generated IPFS link)
+// and writes the decrypted content to w.
+// Returns the encryption header of the file or an error if the download or decryption fails.
+func DownloadDecrypted(info FileInfo, w io.Writer, kp KeyProvider) (EncryptionHeader, error) {
+	link, err := fileLink(info)
+	if err != nil {
+		return EncryptionHeader{}, err
+	}
+
+	body, err := openLink(link)
+	if err != nil {
+		return EncryptionHeader{}, err
+	}
+	defer body.Close()
+
+	r, header, err := NewDecryptingReader(body, kp)
+	if err != nil {
+		log.Printf("Failed to decrypt file %s: %v", info.FileUUID, err)
+		return header, err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		log.Printf("Failed to decrypt file %s: %v", info.FileUUID, err)
+		return header, err
+	}
+	return header, nil
+}
+
+// encryptFiles returns a copy of files with their content encrypted by kp. The original content
+// type is kept in the encryption header and the uploaded content type is "application/octet-stream".
+func encryptFiles(files []WholeFile, kp KeyProvider) ([]WholeFile, error) {
+	if kp == nil {
+		return files, nil
+	}
+
+	encrypted := make([]WholeFile, len(files))
+	for i, file := range files {
+		var buf bytes.Buffer
+		if err := EncryptStream(&buf, strings.NewReader(file.Content), kp, file.Metadata.ContentType); err != nil {
+			log.Printf("Failed to encrypt file %s: %v", file.Metadata.FileName, err)
+			return nil, fmt.Errorf("failed to encrypt file %s: %w", file.Metadata.FileName, err)
+		}
+		encrypted[i] = file
+		encrypted[i].Content = buf.String()
+		encrypted[i].Metadata.ContentType = defaultContentType
+	}
+	return encrypted, nil
+}
+
+// newGCM creates an AES-256-GCM cipher for key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce derives the nonce of a chunk from the file's nonce prefix, the chunk counter and
+// whether it is the final chunk, so chunks cannot be reordered, dropped or truncated unnoticed.
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func testKeyProvider(t *testing.T) *StaticKeyProvider {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return NewStaticKeyProvider("test-key", key)
+}
+
+func TestEncryptStream_RoundTrip(t *testing.T) {
+	kp := testKeyProvider(t)
+
+	for _, size := range []int{0, 1, DefaultEncryptionChunkSize - 1, DefaultEncryptionChunkSize, DefaultEncryptionChunkSize + 1, 3 * DefaultEncryptionChunkSize} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		var encrypted bytes.Buffer
+		if err := EncryptStream(&encrypted, bytes.NewReader(plain), kp, "image/png"); err != nil {
+			t.Fatalf("EncryptStream(%d bytes) returned error: %v", size, err)
+		}
+		if size >= 16 && bytes.Contains(encrypted.Bytes(), plain) {
+			t.Fatalf("ciphertext contains the plaintext for %d bytes", size)
+		}
+
+		r, header, err := NewDecryptingReader(&encrypted, kp)
+		if err != nil {
+			t.Fatalf("NewDecryptingReader(%d bytes) returned error: %v", size, err)
+		}
+		if header.KeyID != "test-key" || header.ContentType != "image/png" || header.Algorithm != EncryptionAlgorithm {
+			t.Errorf("unexpected header: %+v", header)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("decrypting %d bytes returned error: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("round trip of %d bytes returned different content", size)
+		}
+	}
+}
+
+func TestDecryptingReader_DetectsTampering(t *testing.T) {
+	kp := testKeyProvider(t)
+	plain := make([]byte, 2*DefaultEncryptionChunkSize+10)
+
+	var encrypted bytes.Buffer
+	if err := EncryptStream(&encrypted, bytes.NewReader(plain), kp, ""); err != nil {
+		t.Fatal(err)
+	}
+	data := encrypted.Bytes()
+
+	modified := append([]byte{}, data...)
+	modified[len(modified)-5] ^= 1
+	// Dropping the final chunk must not look like a complete file
+	truncated := data[:len(data)-(10+16)]
+
+	for name, content := range map[string][]byte{"modified": modified, "truncated": truncated} {
+		r, _, err := NewDecryptingReader(bytes.NewReader(content), kp)
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if err == nil {
+			t.Errorf("%s content decrypted without error", name)
+		}
+	}
+
+	if _, _, err := NewDecryptingReader(bytes.NewReader([]byte("plain text")), kp); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("expected ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestDownloadDecrypted(t *testing.T) {
+	defer gock.Off()
+	kp := testKeyProvider(t)
+
+	var encrypted bytes.Buffer
+	if err := EncryptStream(&encrypted, bytes.NewReader([]byte("top secret")), kp, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	gock.New("https://gateway.example.com").Get("/secret").Reply(200).Body(bytes.NewReader(encrypted.Bytes()))
+
+	var out bytes.Buffer
+	header, err := DownloadDecrypted(FileInfo{FileUUID: "file-1", Link: "https://gateway.example.com/secret"}, &out, kp)
+	if err != nil {
+		t.Fatalf("DownloadDecrypted returned error: %v", err)
+	}
+	if out.String() != "top secret" || header.ContentType != "text/plain" {
+		t.Errorf("unexpected result %q, %+v", out.String(), header)
+	}
+}
@@ -3,39 +3,71 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"iter"
 	"log"
+	"strconv"
 
 	"github.com/LeonardoRyuta/apillon-storage/requests"
 )
 
-// GetBucketContent retrieves the raw content of a storage bucket by its UUID.
-// Returns the raw response as a string, or an error if the request fails.
-func GetBucketContent(bucketUuid string) (string, error) {
-	if bucketUuid == "" {
-		return "", fmt.Errorf("bucket uuid is required")
-	}
-
-	path := "/storage/buckets/" + bucketUuid + "/content"
+// DefaultListPageSize is the number of files requested per page when ListFilesOptions.Limit is not set.
+const DefaultListPageSize = 100
+
+// ListFilesOptions filters, orders and paginates the files listed in a bucket.
+// The zero value lists the first page with the API's defaults.
+type ListFilesOptions struct {
+	Search        string     // Only files whose name contains this text
+	DirectoryUUID string     // Only files in this directory
+	FileStatus    FileStatus // Only files with this status; zero for any status
+	Page          int        // Page to list, starting at 1
+	Limit         int        // Number of files per page
+	OrderBy       string     // Field to order by, e.g. "name" or "createTime"
+	Desc          bool       // Order descending instead of ascending
+}
 
-	res, err := requests.GetReq(path, nil)
-	if err != nil {
-		log.Printf("Failed to get bucket content %s: %v", bucketUuid, err)
-		return "", err
+// params returns the query parameters for the options.
+func (o ListFilesOptions) params() map[string]string {
+	params := map[string]string{}
+	if o.Search != "" {
+		params["search"] = o.Search
 	}
-
-	log.Printf("Bucket content retrieved successfully for bucket %s: %s", bucketUuid, res)
-	return res, nil
+	if o.DirectoryUUID != "" {
+		params["directoryUuid"] = o.DirectoryUUID
+	}
+	if o.FileStatus != 0 {
+		params["fileStatus"] = strconv.Itoa(int(o.FileStatus))
+	}
+	if o.Page > 0 {
+		params["page"] = strconv.Itoa(o.Page)
+	}
+	if o.Limit > 0 {
+		params["limit"] = strconv.Itoa(o.Limit)
+	}
+	if o.OrderBy != "" {
+		params["orderBy"] = o.OrderBy
+	}
+	if o.Desc {
+		params["desc"] = "true"
+	}
+	return params
 }
 
-// ListFilesInBucket lists all files in a given bucket by its UUID.
+// ListFilesInBucket lists the first page of files in a given bucket by its UUID.
+// Use ListFilesInBucketWithOptions to filter and paginate, or IterateFilesInBucket to walk every page.
 // Returns a ListFilesResponse struct or an error if the request or unmarshalling fails.
 func ListFilesInBucket(bucketUuid string) (ListFilesResponse, error) {
+	return ListFilesInBucketWithOptions(bucketUuid, ListFilesOptions{})
+}
+
+// ListFilesInBucketWithOptions lists one page of files in a bucket, filtered and ordered by opts.
+// Returns a ListFilesResponse struct or an error if the request or unmarshalling fails.
+func ListFilesInBucketWithOptions(bucketUuid string, opts ListFilesOptions) (ListFilesResponse, error) {
 	if bucketUuid == "" {
 		return ListFilesResponse{}, fmt.Errorf("bucket uuid is required")
 	}
 
 	path := "/storage/buckets/" + bucketUuid + "/files"
-	res, err := requests.GetReq(path, nil)
+	res, err := requests.GetReq(path, opts.params())
 	if err != nil {
 		log.Printf("Failed to list files in bucket %s: %v", bucketUuid, err)
 		return ListFilesResponse{}, err
@@ -47,7 +79,81 @@ func ListFilesInBucket(bucketUuid string) (ListFilesResponse, error) {
 		return ListFilesResponse{}, fmt.Errorf("failed to unmarshal list files response: %w. Raw response: %s", errUnmarshal, res)
 	}
 
-	log.Printf("Files in bucket %s: %s", bucketUuid, res)
+	log.Printf("Listed %d of %d files in bucket %s", len(fileList.Data.Items), fileList.Data.Total, bucketUuid)
+	return fileList, nil
+}
+
+// IterateFilesInBucket returns an iterator over every file in a bucket matching opts, fetching
+// pages of opts.Limit files (DefaultListPageSize if unset) as the loop advances, starting at opts.Page.
+// A failed request is yielded as an error and ends the iteration.
+func IterateFilesInBucket(bucketUuid string, opts ListFilesOptions) iter.Seq2[FileInfo, error] {
+	return func(yield func(FileInfo, error) bool) {
+		if opts.Page <= 0 {
+			opts.Page = 1
+		}
+		if opts.Limit <= 0 {
+			opts.Limit = DefaultListPageSize
+		}
+
+		for {
+			resp, err := ListFilesInBucketWithOptions(bucketUuid, opts)
+			if err != nil {
+				yield(FileInfo{}, err)
+				return
+			}
+			for _, info := range resp.Data.Items {
+				if !yield(info, nil) {
+					return
+				}
+			}
+			if len(resp.Data.Items) < opts.Limit || opts.Page*opts.Limit >= resp.Data.Total {
+				return
+			}
+			opts.Page++
+		}
+	}
+}
+
+// ListAllFilesInBucket collects every file in a bucket matching opts by walking all pages.
+// Returns the files or the first error.
+func ListAllFilesInBucket(bucketUuid string, opts ListFilesOptions) ([]FileInfo, error) {
+	var files []FileInfo
+	for info, err := range IterateFilesInBucket(bucketUuid, opts) {
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// ListSessionFiles lists the first page of files that were registered in an upload session.
+// Returns a ListFilesResponse struct or an error if the request or unmarshalling fails.
+func ListSessionFiles(bucketUuid string, sessionUuid string) (ListFilesResponse, error) {
+	return ListSessionFilesWithOptions(bucketUuid, sessionUuid, ListFilesOptions{})
+}
+
+// ListSessionFilesWithOptions lists one page of the files registered in an upload session.
+// Returns a ListFilesResponse struct or an error if the request or unmarshalling fails.
+func ListSessionFilesWithOptions(bucketUuid string, sessionUuid string, opts ListFilesOptions) (ListFilesResponse, error) {
+	if bucketUuid == "" || sessionUuid == "" {
+		return ListFilesResponse{}, fmt.Errorf("bucket uuid and session uuid are required")
+	}
+
+	path := "/storage/buckets/" + bucketUuid + "/upload/" + sessionUuid + "/files"
+	res, err := requests.GetReq(path, opts.params())
+	if err != nil {
+		log.Printf("Failed to list files of session %s in bucket %s: %v", sessionUuid, bucketUuid, err)
+		return ListFilesResponse{}, err
+	}
+
+	var fileList ListFilesResponse
+	if errUnmarshal := json.Unmarshal([]byte(res), &fileList); errUnmarshal != nil {
+		log.Printf("Failed to unmarshal JSON response from list files of session %s in bucket %s: %v. Raw response: %s", sessionUuid, bucketUuid, errUnmarshal, res)
+		return ListFilesResponse{}, fmt.Errorf("failed to unmarshal list session files response: %w. Raw response: %s", errUnmarshal, res)
+	}
+
+	log.Printf("Listed %d of %d files in session %s of bucket %s", len(fileList.Data.Items), fileList.Data.Total, sessionUuid, bucketUuid)
 	return fileList, nil
 }
 
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func mockFilesPage(bucketUUID string, page int, total int, names ...string) {
+	items := make([]map[string]any, len(names))
+	for i, name := range names {
+		items[i] = map[string]any{"fileUuid": "uuid-" + name, "name": name}
+	}
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/"+bucketUUID+"/files").
+		MatchParam("page", "^"+strconv.Itoa(page)+"$").
+		MatchParam("limit", "^2$").
+		MatchParam("search", "^report 2025$").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"total": total, "items": items}})
+}
+
+func TestIterateFilesInBucket_WalksAllPages(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockFilesPage(bucketUUID, 1, 5, "a", "b")
+	mockFilesPage(bucketUUID, 2, 5, "c", "d")
+	mockFilesPage(bucketUUID, 3, 5, "e")
+
+	files, err := ListAllFilesInBucket(bucketUUID, ListFilesOptions{Search: "report 2025", Limit: 2})
+	if err != nil {
+		t.Fatalf("ListAllFilesInBucket returned error: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listed %v, want %v", names, want)
+	}
+	if !gock.IsDone() {
+		t.Error("expected every page to be requested")
+	}
+}
+
+func TestIterateFilesInBucket_StopsEarly(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	mockFilesPage(bucketUUID, 1, 5, "a", "b")
+	mockFilesPage(bucketUUID, 2, 5, "c", "d")
+
+	var seen []string
+	for info, err := range IterateFilesInBucket(bucketUUID, ListFilesOptions{Search: "report 2025", Limit: 2}) {
+		if err != nil {
+			t.Fatalf("iteration returned error: %v", err)
+		}
+		seen = append(seen, info.Name)
+		if len(seen) == 3 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(seen, []string{"a", "b", "c"}) {
+		t.Errorf("saw %v", seen)
+	}
+}
+
+func TestIterateFilesInBucket_YieldsErrors(t *testing.T) {
+	defer gock.Off()
+
+	gock.New("https://api.apillon.io").Get("/storage/buckets/test-bucket-uuid/files").Reply(200).BodyString("not json")
+
+	if _, err := ListAllFilesInBucket("test-bucket-uuid", ListFilesOptions{}); err == nil {
+		t.Error("expected an error for an invalid response")
+	}
+}
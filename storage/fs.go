@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+)
+
+// errNotDir is returned when a file is used as a directory.
+var errNotDir = errors.New("not a directory")
+
+// FS is a read-only fs.FS backed by the content of a bucket. Directories are listed when first
+// used and cached; file content is streamed from the file's link with Range requests when seeking.
+// FS implements fs.ReadDirFS and fs.StatFS and can be used with fs.WalkDir, template.ParseFS and
+// http.FileServer(http.FS(...)).
+type FS struct {
+	bucketUuid string
+
+	mu   sync.Mutex
+	dirs map[string][]ContentItem // Cached listings by directory path, "." for the bucket root
+}
+
+// NewFS returns a read-only filesystem for the bucket with the given UUID.
+func NewFS(bucketUuid string) *FS {
+	return &FS{bucketUuid: bucketUuid, dirs: make(map[string][]ContentItem)}
+}
+
+// Refresh drops the cached directory listings so later calls see the current bucket content.
+func (f *FS) Refresh() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dirs = make(map[string][]ContentItem)
+}
+
+// Open opens the named file or directory.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	item, err := f.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if item.IsDir() {
+		return &bucketDir{fsys: f, name: name, item: item}, nil
+	}
+	return &bucketFile{name: name, item: item}, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	items, err := f.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, len(items))
+	for i, item := range items {
+		entries[i] = contentInfo{item: item}
+	}
+	return entries, nil
+}
+
+// Stat returns a FileInfo describing the named file or directory. Its Sys method returns the ContentItem.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	item, err := f.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return contentInfo{item: item}, nil
+}
+
+// stat returns the content item at name, or a directory item named "." for the root.
+func (f *FS) stat(name string) (ContentItem, error) {
+	if name == "." {
+		return ContentItem{Type: ContentDirectory, Name: "."}, nil
+	}
+	items, err := f.readDir(path.Dir(name))
+	if err != nil {
+		return ContentItem{}, err
+	}
+	if item, ok := findContentItem(items, path.Base(name)); ok {
+		return item, nil
+	}
+	return ContentItem{}, fs.ErrNotExist
+}
+
+// readDir returns the items of the directory at name, listing it on first use.
+func (f *FS) readDir(name string) ([]ContentItem, error) {
+	f.mu.Lock()
+	items, ok := f.dirs[name]
+	f.mu.Unlock()
+	if ok {
+		return items, nil
+	}
+
+	dir, err := f.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDir() {
+		return nil, errNotDir
+	}
+	items, err = listDirectory(f.bucketUuid, dir.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.dirs[name] = items
+	f.mu.Unlock()
+	return items, nil
+}
+
+// contentInfo adapts a ContentItem to fs.FileInfo and fs.DirEntry.
+type contentInfo struct {
+	item ContentItem
+}
+
+func (i contentInfo) Name() string { return i.item.Name }
+func (i contentInfo) IsDir() bool  { return i.item.IsDir() }
+func (i contentInfo) Sys() any     { return i.item }
+
+func (i contentInfo) Size() int64 {
+	if i.item.IsDir() {
+		return 0
+	}
+	return i.item.Size
+}
+
+func (i contentInfo) Mode() fs.FileMode {
+	if i.item.IsDir() {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (i contentInfo) ModTime() time.Time { return i.item.UpdateTime.Time }
+
+func (i contentInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i contentInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// bucketFile is an open file of an FS. Content is requested on the first Read after opening or seeking.
+type bucketFile struct {
+	name   string
+	item   ContentItem
+	body   io.ReadCloser
+	offset int64
+	closed bool
+}
+
+func (f *bucketFile) Stat() (fs.FileInfo, error) { return contentInfo{item: f.item}, nil }
+
+func (f *bucketFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.offset >= f.item.Size {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		link, err := fileLink(FileInfo{FileUUID: f.item.UUID, CID: f.item.CID, Link: f.item.Link})
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		body, err := openLinkAt(link, f.offset)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.body = body
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *bucketFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.item.Size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *bucketFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+// bucketDir is an open directory of an FS.
+type bucketDir struct {
+	fsys    *FS
+	name    string
+	item    ContentItem
+	entries []fs.DirEntry
+	read    bool
+	closed  bool
+}
+
+func (d *bucketDir) Stat() (fs.FileInfo, error) { return contentInfo{item: d.item}, nil }
+
+func (d *bucketDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *bucketDir) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
+
+// ReadDir returns the next n entries of the directory, or all remaining entries if n <= 0.
+func (d *bucketDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
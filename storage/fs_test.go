@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestFS(t *testing.T) {
+	defer gock.Off()
+
+	files := map[string]string{
+		"/a": "hello",
+		"/b": "# docs\nwith more content",
+		"/c": "png bytes",
+	}
+	gateway, _ := testGateway(t, files)
+
+	bucketUUID := "test-bucket-uuid"
+	updated := "2025-01-02T03:04:05Z"
+	mockContent(bucketUUID, "dir-docs", []map[string]any{
+		{"type": 2, "uuid": "file-b", "name": "b.md", "size": len(files["/b"]), "link": gateway.URL + "/b", "updateTime": updated},
+		{"type": 1, "uuid": "dir-img", "name": "img", "updateTime": updated},
+	})
+	mockContent(bucketUUID, "dir-img", []map[string]any{
+		{"type": 2, "uuid": "file-c", "name": "c.png", "size": len(files["/c"]), "link": gateway.URL + "/c", "updateTime": updated},
+	})
+	mockContent(bucketUUID, "", []map[string]any{
+		{"type": 2, "uuid": "file-a", "name": "a.txt", "size": len(files["/a"]), "link": gateway.URL + "/a", "updateTime": updated},
+		{"type": 1, "uuid": "dir-docs", "name": "docs", "updateTime": updated},
+	})
+
+	fsys := NewFS(bucketUUID)
+	if err := fstest.TestFS(fsys, "a.txt", "docs/b.md", "docs/img/c.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(fsys, "docs/b.md")
+	if err != nil || string(data) != files["/b"] {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+
+	f, err := fsys.Open("docs/b.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.(io.Seeker).Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, _ := io.ReadAll(f)
+	if string(rest) != "with more content" {
+		t.Errorf("read after seek = %q", rest)
+	}
+
+	if _, err := fsys.Stat("docs/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(missing) error = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+)
+
+// DefaultClusterInfoTTL is how long CachedIPFSClusterInfo reuses the cluster info it fetched.
+const DefaultClusterInfoTTL = time.Hour
+
+// ipfsTokenSubject is the subject of the access tokens accepted by Apillon gateways.
+const ipfsTokenSubject = "IPFS-token"
+
+// GatewayStyle selects how links built by a Gateway address content.
+type GatewayStyle int
+
+const (
+	GatewaySubdomain GatewayStyle = iota // https://<cidv1>.ipfs.<host>/<path>, each CID gets its own origin
+	GatewayPath                          // https://<host>/ipfs/<cid>/<path>
+)
+
+// GatewayOptions configures a Gateway. The zero value builds subdomain links with tokens that do not expire.
+type GatewayOptions struct {
+	Style    GatewayStyle  // Link style; defaults to GatewaySubdomain
+	TokenTTL time.Duration // Lifetime of the access tokens; zero for tokens without expiry
+	// ForceV1 converts CIDv0 ("Qm...") to CIDv1 in path-style links too. Subdomain links always use
+	// CIDv1 because host names are case-insensitive.
+	ForceV1 bool
+	// SubdomainHost is the host below which subdomain links are built, e.g. "ipfs.example.com"
+	// for https://<cid>.ipfs.example.com. Defaults to the host of the cluster's IPFS gateway.
+	SubdomainHost string
+}
+
+// Gateway builds signed links to content on the project's IPFS gateway locally, without a
+// request per CID as made by GetOrGenerateIPFSLink. Links carry an HS256 JWT access token signed
+// with the cluster secret. A Gateway is safe for concurrent use.
+type Gateway struct {
+	projectUUID string
+	secret      []byte
+	scheme      string
+	host        string // Host of path-style links
+	basePath    string // Path before "/ipfs/" in path-style links, without trailing slash
+	subHost     string // Host below which subdomain links are built
+	opts        GatewayOptions
+	now         func() time.Time
+}
+
+// NewGateway returns a Gateway for the cluster described by info, as returned by GetIPFSClusterInfo.
+// Returns an error if the secret, project UUID or gateway URL is missing or invalid.
+func NewGateway(info IPFSClusterInfoData, opts GatewayOptions) (*Gateway, error) {
+	if info.Secret == "" || info.ProjectUUID == "" {
+		return nil, fmt.Errorf("cluster info must include the secret and project uuid")
+	}
+	gatewayURL, err := url.Parse(info.IPFSGateway)
+	if err != nil || gatewayURL.Host == "" {
+		return nil, fmt.Errorf("invalid IPFS gateway URL %q", info.IPFSGateway)
+	}
+
+	base := strings.TrimSuffix(strings.TrimSuffix(gatewayURL.Path, "/"), "/ipfs")
+	subHost := opts.SubdomainHost
+	if subHost == "" {
+		subHost = "ipfs." + strings.TrimPrefix(gatewayURL.Host, "ipfs.")
+	}
+	return &Gateway{
+		projectUUID: info.ProjectUUID,
+		secret:      []byte(info.Secret),
+		scheme:      gatewayURL.Scheme,
+		host:        gatewayURL.Host,
+		basePath:    base,
+		subHost:     subHost,
+		opts:        opts,
+		now:         time.Now,
+	}, nil
+}
+
+// NewGatewayFromCluster returns a Gateway for the project's cluster, using CachedIPFSClusterInfo.
+func NewGatewayFromCluster(opts GatewayOptions) (*Gateway, error) {
+	info, err := CachedIPFSClusterInfo()
+	if err != nil {
+		return nil, err
+	}
+	return NewGateway(info, opts)
+}
+
+// Link returns a signed link to the content with the given CID.
+func (g *Gateway) Link(contentCid string) (string, error) {
+	return g.LinkPath(contentCid, "")
+}
+
+// LinkPath returns a signed link to the file at the slash-separated path p inside the
+// directory with the given CID.
+func (g *Gateway) LinkPath(contentCid string, p string) (string, error) {
+	c, err := cid.Parse(contentCid)
+	if err != nil {
+		return "", err
+	}
+	if g.opts.Style == GatewaySubdomain || g.opts.ForceV1 {
+		c = c.ToV1()
+	}
+	token, err := g.Token(c.String())
+	if err != nil {
+		return "", err
+	}
+
+	link := url.URL{Scheme: g.scheme, RawQuery: url.Values{"token": {token}}.Encode()}
+	p = strings.TrimPrefix(p, "/")
+	switch g.opts.Style {
+	case GatewayPath:
+		link.Host = g.host
+		link.Path = g.basePath + "/ipfs/" + c.String() + "/" + p
+	default:
+		link.Host = c.String() + "." + g.subHost
+		link.Path = "/" + p
+	}
+	return link.String(), nil
+}
+
+// Links returns signed links for many CIDs, in the same order. CIDs that cannot be parsed
+// get an empty link and are reported in the joined error.
+func (g *Gateway) Links(cids []string) ([]string, error) {
+	links := make([]string, len(cids))
+	var errs []error
+	for i, c := range cids {
+		link, err := g.Link(c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		links[i] = link
+	}
+	return links, errors.Join(errs...)
+}
+
+// Token returns an access token for the content with the given CID, as a JWT signed with
+// HS256 using the cluster secret. The token expires after GatewayOptions.TokenTTL, if set.
+func (g *Gateway) Token(contentCid string) (string, error) {
+	now := g.now()
+	claims := map[string]any{
+		"cid":          contentCid,
+		"project_uuid": g.projectUUID,
+		"sub":          ipfsTokenSubject,
+		"iat":          now.Unix(),
+	}
+	if g.opts.TokenTTL > 0 {
+		claims["exp"] = now.Add(g.opts.TokenTTL).Unix()
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString(payload)
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
+
+// GenerateIPFSLink returns a signed subdomain link to the content with the given CID, built
+// locally from the cached cluster info. Use a Gateway for other link styles or token lifetimes.
+func GenerateIPFSLink(contentCid string) (string, error) {
+	g, err := NewGatewayFromCluster(GatewayOptions{})
+	if err != nil {
+		return "", err
+	}
+	return g.Link(contentCid)
+}
+
+// GenerateIPFSLinks returns signed subdomain links for many CIDs, in the same order, built
+// locally from the cached cluster info. CIDs that cannot be parsed are reported in the joined error.
+func GenerateIPFSLinks(cids []string) ([]string, error) {
+	g, err := NewGatewayFromCluster(GatewayOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return g.Links(cids)
+}
+
+// clusterInfoCache holds the cluster info fetched by CachedIPFSClusterInfo.
+var clusterInfoCache struct {
+	mu      sync.Mutex
+	info    IPFSClusterInfoData
+	fetched time.Time
+}
+
+// CachedIPFSClusterInfo returns the IPFS cluster info, fetching it with GetIPFSClusterInfo
+// at most once per DefaultClusterInfoTTL.
+func CachedIPFSClusterInfo() (IPFSClusterInfoData, error) {
+	clusterInfoCache.mu.Lock()
+	defer clusterInfoCache.mu.Unlock()
+
+	if !clusterInfoCache.fetched.IsZero() && time.Since(clusterInfoCache.fetched) < DefaultClusterInfoTTL {
+		return clusterInfoCache.info, nil
+	}
+
+	resp, err := GetIPFSClusterInfo()
+	if err != nil {
+		return IPFSClusterInfoData{}, err
+	}
+	if resp.Status >= 400 {
+		return IPFSClusterInfoData{}, fmt.Errorf("IPFS cluster info returned status %d", resp.Status)
+	}
+	clusterInfoCache.info, clusterInfoCache.fetched = resp.Data, time.Now()
+	log.Printf("Cached IPFS cluster info for project %s", resp.Data.ProjectUUID)
+	return resp.Data, nil
+}
+
+// ResetIPFSClusterInfoCache drops the cached cluster info, e.g. after the cluster secret was rotated.
+func ResetIPFSClusterInfoCache() {
+	clusterInfoCache.mu.Lock()
+	defer clusterInfoCache.mu.Unlock()
+	clusterInfoCache.info, clusterInfoCache.fetched = IPFSClusterInfoData{}, time.Time{}
+}
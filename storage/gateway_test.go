@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+var testClusterInfo = IPFSClusterInfoData{Secret: "cluster-secret", ProjectUUID: "project-uuid", IPFSGateway: "https://ipfs.example.com/ipfs/"}
+
+func TestGateway_SubdomainLink(t *testing.T) {
+	g, err := NewGateway(testClusterInfo, GatewayOptions{TokenTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	g.now = func() time.Time { return now }
+
+	v0 := testCID(t, "page")
+	parsed, _ := cid.Parse(v0)
+	v1 := parsed.ToV1().String()
+
+	link, err := g.LinkPath(v0, "/img/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != v1+".ipfs.example.com" || u.Path != "/img/logo.png" {
+		t.Errorf("unexpected link %s", link)
+	}
+
+	parts := strings.Split(u.Query().Get("token"), ".")
+	if len(parts) != 3 {
+		t.Fatalf("token is not a JWT: %s", u.Query().Get("token"))
+	}
+	mac := hmac.New(sha256.New, []byte(testClusterInfo.Secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != parts[2] {
+		t.Error("token signature does not verify with the cluster secret")
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims["cid"] != v1 || claims["project_uuid"] != "project-uuid" || claims["exp"] != float64(now.Add(time.Hour).Unix()) {
+		t.Errorf("unexpected claims %v", claims)
+	}
+}
+
+func TestGateway_PathLinks(t *testing.T) {
+	g, err := NewGateway(testClusterInfo, GatewayOptions{Style: GatewayPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v0 := testCID(t, "a")
+	links, err := g.Links([]string{v0, "not-a-cid"})
+	if err == nil {
+		t.Error("expected an error for the invalid CID")
+	}
+	if !strings.HasPrefix(links[0], "https://ipfs.example.com/ipfs/"+v0+"/?token=") || links[1] != "" {
+		t.Errorf("unexpected links %q", links)
+	}
+	if strings.Contains(links[0], "exp") {
+		t.Error("tokens should not expire without a TokenTTL")
+	}
+}
+
+func TestCachedIPFSClusterInfo(t *testing.T) {
+	defer gock.Off()
+	ResetIPFSClusterInfoCache()
+	defer ResetIPFSClusterInfoCache()
+
+	gock.New("https://api.apillon.io").
+		Get("/storage/ipfs-cluster-info").
+		Times(1).
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{
+			"secret": testClusterInfo.Secret, "project_uuid": testClusterInfo.ProjectUUID, "ipfsGateway": testClusterInfo.IPFSGateway,
+		}})
+
+	links, err := GenerateIPFSLinks([]string{testCID(t, "a"), testCID(t, "b")})
+	if err != nil || len(links) != 2 {
+		t.Fatalf("GenerateIPFSLinks = %q, %v", links, err)
+	}
+	// Served from the cache; a second request would not match any mock
+	if _, err := GenerateIPFSLink(testCID(t, "c")); err != nil {
+		t.Errorf("GenerateIPFSLink returned error: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// ErrSkipFile is returned by a PreUploadHook to leave a file out of the upload without failing it.
+var ErrSkipFile = errors.New("skip file")
+
+// ErrFileTooLarge is returned by the hook created with MaxFileSize.
+var ErrFileTooLarge = errors.New("file too large")
+
+// PreUploadHook inspects or transforms a file before it is uploaded. It returns the metadata and
+// content to upload; a nil reader keeps the original content. Returning ErrSkipFile leaves the file
+// out of the upload, and any other error rejects the file and aborts the upload before anything is sent.
+type PreUploadHook func(metadata FileMetadata, content io.Reader) (FileMetadata, io.Reader, error)
+
+// PostUploadHook is called after a file has been uploaded to its signed URL, with the session's entry
+// for the file. Hooks of files in different sessions may run concurrently. Returning an error fails
+// the file, and its session is not ended.
+type PostUploadHook func(item FileItem) error
+
+// MaxFileSize returns a PreUploadHook that rejects files larger than limit bytes with ErrFileTooLarge.
+func MaxFileSize(limit int64) PreUploadHook {
+	return func(metadata FileMetadata, content io.Reader) (FileMetadata, io.Reader, error) {
+		n, err := io.Copy(io.Discard, io.LimitReader(content, limit+1))
+		if err != nil {
+			return metadata, nil, err
+		}
+		if n > limit {
+			return metadata, nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrFileTooLarge, localFilePath(metadata), limit)
+		}
+		return metadata, nil, nil
+	}
+}
+
+// runPreUploadHooks passes every file through hooks in order. It returns the files to upload and the
+// metadata of the skipped files, or an error for the first rejected file.
+func runPreUploadHooks(files []WholeFile, hooks []PreUploadHook) ([]WholeFile, []FileMetadata, error) {
+	if len(hooks) == 0 {
+		return files, nil, nil
+	}
+
+	var kept []WholeFile
+	var skipped []FileMetadata
+	for _, file := range files {
+		out, err := runFileHooks(file, hooks)
+		if errors.Is(err, ErrSkipFile) {
+			log.Printf("Skipping file %s: %v", localFilePath(file.Metadata), err)
+			skipped = append(skipped, file.Metadata)
+			continue
+		}
+		if err != nil {
+			log.Printf("File %s rejected by pre-upload hook: %v", localFilePath(file.Metadata), err)
+			return nil, nil, fmt.Errorf("file %s rejected: %w", localFilePath(file.Metadata), err)
+		}
+		kept = append(kept, out)
+	}
+	return kept, skipped, nil
+}
+
+// runFileHooks applies hooks to a single file.
+func runFileHooks(file WholeFile, hooks []PreUploadHook) (WholeFile, error) {
+	for _, hook := range hooks {
+		metadata, content, err := hook(file.Metadata, strings.NewReader(file.Content))
+		if err != nil {
+			return file, err
+		}
+		file.Metadata = metadata
+		if content != nil {
+			data, err := io.ReadAll(content)
+			if err != nil {
+				return file, fmt.Errorf("failed to read transformed content: %w", err)
+			}
+			file.Content = string(data)
+		}
+	}
+
+	if file.Content == "" || file.Metadata.FileName == "" {
+		return file, fmt.Errorf("pre-upload hook left empty content or file name")
+	}
+	return file, nil
+}
+
+// runPostUploadHooks calls hooks in order with the uploaded file and returns the first error.
+func runPostUploadHooks(item FileItem, hooks []PostUploadHook) error {
+	for _, hook := range hooks {
+		if err := hook(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
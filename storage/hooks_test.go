@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestRunPreUploadHooks(t *testing.T) {
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "index.html"}, Content: "<p>  hi  </p>"},
+		{Metadata: FileMetadata{FileName: ".DS_Store"}, Content: "junk"},
+	}
+	minify := func(meta FileMetadata, content io.Reader) (FileMetadata, io.Reader, error) {
+		data, _ := io.ReadAll(content)
+		return meta, strings.NewReader(strings.Join(strings.Fields(string(data)), "")), nil
+	}
+	skipHidden := func(meta FileMetadata, content io.Reader) (FileMetadata, io.Reader, error) {
+		if strings.HasPrefix(meta.FileName, ".") {
+			return meta, nil, ErrSkipFile
+		}
+		return meta, nil, nil
+	}
+
+	kept, skipped, err := runPreUploadHooks(files, []PreUploadHook{skipHidden, minify, MaxFileSize(100)})
+	if err != nil {
+		t.Fatalf("runPreUploadHooks returned error: %v", err)
+	}
+	if len(kept) != 1 || kept[0].Content != "<p>hi</p>" {
+		t.Errorf("unexpected kept files: %+v", kept)
+	}
+	if len(skipped) != 1 || skipped[0].FileName != ".DS_Store" {
+		t.Errorf("unexpected skipped files: %+v", skipped)
+	}
+
+	_, _, err = runPreUploadHooks(files, []PreUploadHook{MaxFileSize(5)})
+	if !errors.Is(err, ErrFileTooLarge) || !strings.Contains(err.Error(), "index.html") {
+		t.Errorf("expected index.html to be rejected with ErrFileTooLarge, got %v", err)
+	}
+}
+
+func TestUploadFileProcessWithOptions_Hooks(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "a.txt", Path: "docs"}, Content: "a"},
+		{Metadata: FileMetadata{FileName: "skip.txt"}, Content: "b"},
+	}
+
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload$").
+		Reply(200).
+		JSON(map[string]any{"data": map[string]any{
+			"sessionUuid": "session-1",
+			"files":       []map[string]any{{"fileName": "a.txt", "path": "docs", "url": "https://s3.example.com/a", "fileUuid": "file-a"}},
+		}})
+	gock.New("https://s3.example.com").Put("/a").BodyString("A").Reply(200)
+	gock.New("https://api.apillon.io").Post("/upload/session-1/end").Reply(200).JSON(map[string]any{"data": true})
+
+	var mu sync.Mutex
+	var uploaded []FileItem
+	opts := UploadOptions{
+		PreUpload: []PreUploadHook{func(meta FileMetadata, content io.Reader) (FileMetadata, io.Reader, error) {
+			if meta.FileName == "skip.txt" {
+				return meta, nil, ErrSkipFile
+			}
+			data, _ := io.ReadAll(content)
+			return meta, strings.NewReader(strings.ToUpper(string(data))), nil
+		}},
+		PostUpload: []PostUploadHook{func(item FileItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			uploaded = append(uploaded, item)
+			return nil
+		}},
+	}
+
+	result, err := UploadFileProcessWithOptions(bucketUUID, files, opts)
+	if err != nil {
+		t.Fatalf("UploadFileProcessWithOptions returned error: %v", err)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected the transformed file to be uploaded")
+	}
+	if len(result.Files) != 1 || len(result.Skipped) != 1 || result.Skipped[0].FileName != "skip.txt" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(uploaded) != 1 || uploaded[0].FileUUID != "file-a" || uploaded[0].Path == nil || *uploaded[0].Path != "docs" {
+		t.Errorf("post-upload hook received %+v", uploaded)
+	}
+}
+
+func TestUploadFileProcessWithOptions_FailingPostUploadHook(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "a.txt"}, Content: "a"},
+		{Metadata: FileMetadata{FileName: "b.txt"}, Content: "b"},
+	}
+
+	// Both files are uploaded and the session is still ended after the hook fails for a.txt
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload$").
+		Reply(200).
+		JSON(map[string]any{"data": map[string]any{
+			"sessionUuid": "session-1",
+			"files": []map[string]any{
+				{"fileName": "a.txt", "url": "https://s3.example.com/a"},
+				{"fileName": "b.txt", "url": "https://s3.example.com/b"},
+			},
+		}})
+	gock.New("https://s3.example.com").Put("/a").Reply(200)
+	gock.New("https://s3.example.com").Put("/b").Reply(200)
+	gock.New("https://api.apillon.io").Post("/upload/session-1/end").Reply(200).JSON(map[string]any{"data": true})
+
+	hookErr := errors.New("notification failed")
+	opts := UploadOptions{PostUpload: []PostUploadHook{func(item FileItem) error {
+		if item.FileName == "a.txt" {
+			return hookErr
+		}
+		return nil
+	}}}
+
+	result, err := UploadFileProcessWithOptions(bucketUUID, files, opts)
+	if !errors.Is(err, hookErr) {
+		t.Errorf("expected the hook error to be returned, got %v", err)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected every file to be uploaded and the session to be ended")
+	}
+	if len(result.Files) != 2 || !errors.Is(result.Files[0].Err, hookErr) || result.Files[1].Err != nil {
+		t.Errorf("unexpected file results: %+v", result.Files)
+	}
+}
@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultIgnoreFile is the name of the ignore file read from the root of uploaded directories.
+const DefaultIgnoreFile = ".apillonignore"
+
+// IgnoreOptions controls which local files directory uploads and syncs consider.
+type IgnoreOptions struct {
+	// IgnoreFile is the gitignore-syntax file read from the root of the directory.
+	// Defaults to DefaultIgnoreFile. A missing file is not an error.
+	IgnoreFile string
+	// DisableIgnoreFile skips reading the ignore file.
+	DisableIgnoreFile bool
+	// Exclude lists extra gitignore-syntax patterns, applied after the ignore file.
+	Exclude []string
+	// Include, when not empty, keeps only files matching at least one of these patterns.
+	Include []string
+}
+
+// IgnoreMatcher decides whether paths are ignored using gitignore syntax:
+// comments, negation with "!", directory-only patterns ending in "/", patterns anchored
+// to the root with a leading or inner "/", and "*", "?", "[...]" and "**" wildcards.
+// As with git, the last matching pattern wins and files inside an ignored directory stay ignored.
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// NewIgnoreMatcher compiles gitignore-syntax patterns, one per entry.
+func NewIgnoreMatcher(patterns []string) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{}
+	for _, p := range patterns {
+		if err := m.add(p); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ParseIgnore reads gitignore-syntax patterns from r.
+func ParseIgnore(r io.Reader) (*IgnoreMatcher, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewIgnoreMatcher(patterns)
+}
+
+// add compiles a single pattern line. Blank lines and comments are skipped.
+func (m *IgnoreMatcher) add(line string) error {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr, err := globToRegexp(line)
+	if err != nil {
+		return fmt.Errorf("invalid ignore pattern %q: %w", line, err)
+	}
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+
+	rule.re, err = regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid ignore pattern %q: %w", line, err)
+	}
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+// match reports whether the patterns ignore p itself, without looking at its parents.
+func (m *IgnoreMatcher) match(p string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(p) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// Ignored reports whether the slash-separated relative path p is ignored, either directly
+// or because one of its parent directories is.
+func (m *IgnoreMatcher) Ignored(p string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	p = strings.Trim(p, "/")
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if m.match(dir, true) {
+			return true
+		}
+	}
+	return m.match(p, isDir)
+}
+
+// globToRegexp translates a gitignore glob into a regular expression fragment.
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && i > 0 && glob[i-1] == '/' && i+2 == len(glob):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			class, n, err := classToRegexp(glob[i:])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(class)
+			i += n - 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// posixClasses holds the ASCII ranges of the [:name:] classes allowed inside brackets.
+var posixClasses = map[string][][2]rune{
+	"alnum":  {{'0', '9'}, {'A', 'Z'}, {'a', 'z'}},
+	"alpha":  {{'A', 'Z'}, {'a', 'z'}},
+	"ascii":  {{0x00, 0x7f}},
+	"blank":  {{'\t', '\t'}, {' ', ' '}},
+	"cntrl":  {{0x00, 0x1f}, {0x7f, 0x7f}},
+	"digit":  {{'0', '9'}},
+	"graph":  {{'!', '~'}},
+	"lower":  {{'a', 'z'}},
+	"print":  {{' ', '~'}},
+	"punct":  {{'!', '/'}, {':', '@'}, {'[', '`'}, {'{', '~'}},
+	"space":  {{'\t', '\r'}, {' ', ' '}},
+	"upper":  {{'A', 'Z'}},
+	"word":   {{'0', '9'}, {'A', 'Z'}, {'a', 'z'}, {'_', '_'}},
+	"xdigit": {{'0', '9'}, {'A', 'F'}, {'a', 'f'}},
+}
+
+// classToRegexp translates the bracket expression at the start of glob into a regular
+// expression class and returns it with the number of bytes consumed. A leading ']' is a
+// literal, a leading '!' or '^' negates the class, and '/' is never matched.
+func classToRegexp(glob string) (string, int, error) {
+	i := 1
+	negate := i < len(glob) && (glob[i] == '!' || glob[i] == '^')
+	if negate {
+		i++
+	}
+
+	var ranges [][2]rune
+	for first := true; ; first = false {
+		if i >= len(glob) {
+			return "", 0, errors.New("unterminated character class")
+		}
+		if glob[i] == ']' && !first {
+			i++
+			break
+		}
+		if strings.HasPrefix(glob[i:], "[:") {
+			end := strings.Index(glob[i+2:], ":]")
+			if end < 0 {
+				return "", 0, errors.New("unterminated character class")
+			}
+			name := glob[i+2 : i+2+end]
+			class, ok := posixClasses[name]
+			if !ok {
+				return "", 0, fmt.Errorf("unknown character class [:%s:]", name)
+			}
+			ranges = append(ranges, class...)
+			i += end + 4
+			continue
+		}
+
+		lo, n, err := classChar(glob[i:])
+		if err != nil {
+			return "", 0, err
+		}
+		i += n
+		hi := lo
+		if i+1 < len(glob) && glob[i] == '-' && glob[i+1] != ']' {
+			hi, n, err = classChar(glob[i+1:])
+			if err != nil {
+				return "", 0, err
+			}
+			if hi < lo {
+				return "", 0, fmt.Errorf("invalid range %c-%c in character class", lo, hi)
+			}
+			i += n + 1
+		}
+		ranges = append(ranges, [2]rune{lo, hi})
+	}
+
+	var b strings.Builder
+	b.WriteString("[")
+	if negate {
+		b.WriteString("^/")
+	}
+	written := false
+	for _, r := range ranges {
+		// Split ranges around '/' so that path separators stay out of positive classes
+		for _, part := range [][2]rune{{r[0], min(r[1], '/'-1)}, {max(r[0], '/'+1), r[1]}} {
+			if part[0] <= part[1] {
+				fmt.Fprintf(&b, `\x{%x}-\x{%x}`, part[0], part[1])
+				written = true
+			}
+		}
+	}
+	if !negate && !written {
+		// A class of only slashes can never match
+		return `[^\x00-\x{10ffff}]`, i, nil
+	}
+	b.WriteString("]")
+	return b.String(), i, nil
+}
+
+// classChar decodes one, possibly backslash-escaped, character of a bracket expression.
+func classChar(s string) (rune, int, error) {
+	n := 0
+	if s[0] == '\\' {
+		if len(s) < 2 {
+			return 0, 0, errors.New("unterminated character class")
+		}
+		n = 1
+	}
+	r, size := utf8.DecodeRuneInString(s[n:])
+	return r, n + size, nil
+}
+
+// localFilter applies IgnoreOptions to the files of a local directory.
+type localFilter struct {
+	ignoreFile string
+	ignore     *IgnoreMatcher
+	include    *IgnoreMatcher
+}
+
+// newLocalFilter reads the ignore file of localDir and compiles the programmatic patterns.
+func newLocalFilter(localDir string, opts IgnoreOptions) (*localFilter, error) {
+	f := &localFilter{ignore: &IgnoreMatcher{}}
+
+	if !opts.DisableIgnoreFile {
+		f.ignoreFile = opts.IgnoreFile
+		if f.ignoreFile == "" {
+			f.ignoreFile = DefaultIgnoreFile
+		}
+		file, err := os.Open(filepath.Join(localDir, f.ignoreFile))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			matcher, err := ParseIgnore(file)
+			file.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", f.ignoreFile, err)
+			}
+			f.ignore = matcher
+		}
+	}
+
+	for _, p := range opts.Exclude {
+		if err := f.ignore.add(p); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.Include) > 0 {
+		include, err := NewIgnoreMatcher(opts.Include)
+		if err != nil {
+			return nil, err
+		}
+		f.include = include
+	}
+	return f, nil
+}
+
+// skipDir reports whether a directory and everything below it is skipped.
+func (f *localFilter) skipDir(rel string) bool {
+	return f != nil && f.ignore.match(rel, true)
+}
+
+// skipFile reports whether a file is skipped. Parent directories are checked by the caller.
+func (f *localFilter) skipFile(rel string) bool {
+	if f == nil {
+		return false
+	}
+	if rel == f.ignoreFile || f.ignore.match(rel, false) {
+		return true
+	}
+	return f.include != nil && !f.include.Ignored(rel, false)
+}
+
+// skipPath reports whether a path found outside a directory walk, such as a remote file, is skipped.
+func (f *localFilter) skipPath(rel string) bool {
+	if f == nil {
+		return false
+	}
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if f.skipDir(dir) {
+			return true
+		}
+	}
+	return f.skipFile(rel)
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	matcher, err := ParseIgnore(strings.NewReader(`
+# OS and editor files
+.DS_Store
+*.log
+!keep.log
+
+# anchored to the root
+/build
+docs/*.tmp
+
+# directories only
+node_modules/
+cache/
+
+**/secret/**
+`))
+	if err != nil {
+		t.Fatalf("ParseIgnore returned error: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{".DS_Store", false, true},
+		{"assets/img/.DS_Store", false, true},
+		{"debug.log", false, true},
+		{"logs/keep.log", false, false},
+		{"build", true, true},
+		{"build/app.js", false, true},
+		{"src/build", true, false},
+		{"docs/draft.tmp", false, true},
+		{"docs/nested/draft.tmp", false, false},
+		{"node_modules", true, true},
+		{"web/node_modules/react/index.js", false, true},
+		{"cache", false, false},
+		{"cache/data.bin", false, true},
+		{"config/secret/key.pem", false, true},
+		{"index.html", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := matcher.Ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreMatcher_NegationAndEscapes(t *testing.T) {
+	matcher, err := NewIgnoreMatcher([]string{"*.env", "!example.env", `\#notes`, "img/[!a]*.png"})
+	if err != nil {
+		t.Fatalf("NewIgnoreMatcher returned error: %v", err)
+	}
+
+	tests := map[string]bool{
+		".env":          true,
+		"prod.env":      true,
+		"example.env":   false,
+		"#notes":        true,
+		"img/b.png":     true,
+		"img/a.png":     false,
+		"other/img.png": false,
+	}
+	for p, want := range tests {
+		if got := matcher.Ignored(p, false); got != want {
+			t.Errorf("Ignored(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestIgnoreMatcher_CharacterClasses(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"[]]x", "]x", true},
+		{"[]]x", "ax", false},
+		{"[!]]x", "ax", true},
+		{"[!]]x", "]x", false},
+		{"[^a]x", "bx", true},
+		{"[^a]x", "ax", false},
+		{`[\]]x`, `\x`, false},
+		{`[\\]x`, `\x`, true},
+		{"[a-c]x", "bx", true},
+		{"[a-]x", "-x", true},
+		{"[.^$]x", "^x", true},
+		{"[.^$]x", "ax", false},
+		{"[[:digit:]]x", "7x", true},
+		{"[[:digit:]]x", "ax", false},
+		{"[![:alpha:]]x", "1x", true},
+		{"a[/]b", "a/b", false},
+		{"a[!b]c", "a/c", false},
+		{"a[[:punct:]]c", "a/c", false},
+		{"a[[:punct:]]c", "a.c", true},
+		{"a[!-0]c", "a/c", false},
+		{"a[!-0]c", "a.c", true},
+	}
+	for _, tt := range tests {
+		matcher, err := NewIgnoreMatcher([]string{tt.pattern})
+		if err != nil {
+			t.Errorf("NewIgnoreMatcher(%q) returned error: %v", tt.pattern, err)
+			continue
+		}
+		if got := matcher.Ignored(tt.path, false); got != tt.want {
+			t.Errorf("pattern %q: Ignored(%q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{"[]", "[!]", "[abc", "[[:nope:]]", "[z-a]"} {
+		if _, err := NewIgnoreMatcher([]string{pattern}); err == nil {
+			t.Errorf("NewIgnoreMatcher(%q) should fail", pattern)
+		}
+	}
+}
+
+func TestReadLocalDirectory_Ignore(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		".apillonignore":            "node_modules/\n.env\n",
+		".env":                      "SECRET=1",
+		".DS_Store":                 "x",
+		"index.html":                "<html></html>",
+		"img/logo.png":              "png",
+		"img/logo.psd":              "psd",
+		"node_modules/lib/index.js": "js",
+	})
+
+	filter, err := newLocalFilter(dir, IgnoreOptions{Exclude: []string{".DS_Store"}, Include: []string{"*.html", "img/"}})
+	if err != nil {
+		t.Fatalf("newLocalFilter returned error: %v", err)
+	}
+	files, err := readLocalDirectory(dir, "site", filter)
+	if err != nil {
+		t.Fatalf("readLocalDirectory returned error: %v", err)
+	}
+
+	var got []string
+	for _, f := range files {
+		got = append(got, localFilePath(f.Metadata))
+	}
+	want := "site/img/logo.png,site/img/logo.psd,site/index.html"
+	if strings.Join(got, ",") != want {
+		t.Errorf("readLocalDirectory returned %v, want %s", got, want)
+	}
+}
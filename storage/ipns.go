@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+	"github.com/LeonardoRyuta/apillon-storage/requests"
+)
+
+// IPNS is an IPNS record of a bucket. The record's name stays the same while the content it
+// points to is replaced with PublishIPNS.
+type IPNS struct {
+	Timestamps
+	IPNSUUID    string `json:"ipnsUuid"`    // Unique identifier of the record
+	Name        string `json:"name"`        // Name of the record
+	Description string `json:"description"` // Description of the record
+	IPNSName    string `json:"ipnsName"`    // IPNS name (key) the record is published under; empty until first published
+	IPNSValue   string `json:"ipnsValue"`   // Path the name resolves to, e.g. /ipfs/<cid>; empty until first published
+	Link        string `json:"link"`        // Gateway link resolving the IPNS name
+}
+
+// IPNSResponse represents a response containing a single IPNS record.
+type IPNSResponse = APIResponse[IPNS]
+
+// ListIPNSResponse represents a response containing a list of IPNS records.
+type ListIPNSResponse = APIResponse[ListData[IPNS]]
+
+// ListIPNSOptions filters, orders and paginates the IPNS records listed by ListIPNS.
+// The zero value lists the first page with the API's defaults.
+type ListIPNSOptions struct {
+	Search  string // Only records whose name contains this text
+	Page    int    // Page to list, starting at 1
+	Limit   int    // Number of records per page
+	OrderBy string // Field to order by, e.g. "name" or "createTime"
+	Desc    bool   // Order descending instead of ascending
+}
+
+// params returns the query parameters for the options.
+func (o ListIPNSOptions) params() map[string]string {
+	params := map[string]string{}
+	if o.Search != "" {
+		params["search"] = o.Search
+	}
+	if o.Page > 0 {
+		params["page"] = strconv.Itoa(o.Page)
+	}
+	if o.Limit > 0 {
+		params["limit"] = strconv.Itoa(o.Limit)
+	}
+	if o.OrderBy != "" {
+		params["orderBy"] = o.OrderBy
+	}
+	if o.Desc {
+		params["desc"] = "true"
+	}
+	return params
+}
+
+// createIPNSRequest is the body sent to create an IPNS record.
+type createIPNSRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CID         string `json:"cid,omitempty"`
+}
+
+// publishIPNSRequest is the body sent to publish a CID to an IPNS record.
+type publishIPNSRequest struct {
+	CID string `json:"cid"`
+}
+
+// CreateIPNS creates an IPNS record on a bucket. When contentCid is set the record is published
+// to it right away; otherwise publish later with PublishIPNS.
+// Returns the created record, or an error if the request fails or the API returns an error.
+func CreateIPNS(bucketUuid string, name string, description string, contentCid string) (IPNS, error) {
+	if bucketUuid == "" {
+		return IPNS{}, fmt.Errorf("bucket uuid is required")
+	}
+	if name == "" {
+		return IPNS{}, fmt.Errorf("ipns name is required")
+	}
+	if contentCid != "" {
+		if _, err := cid.Parse(contentCid); err != nil {
+			return IPNS{}, fmt.Errorf("invalid CID %q: %w", contentCid, err)
+		}
+	}
+
+	bodyBytes, err := json.Marshal(createIPNSRequest{Name: name, Description: description, CID: contentCid})
+	if err != nil {
+		log.Printf("Failed to marshal create IPNS request for bucket %s: %v", bucketUuid, err)
+		return IPNS{}, err
+	}
+
+	res, err := requests.PostReq("/storage/buckets/"+bucketUuid+"/ipns", strings.NewReader(string(bodyBytes)))
+	if err != nil {
+		log.Printf("Failed to create IPNS record %s in bucket %s: %v", name, bucketUuid, err)
+		return IPNS{}, err
+	}
+
+	record, err := decodeResponse[IPNS](res, "create IPNS")
+	if err != nil {
+		log.Printf("Failed to create IPNS record %s in bucket %s: %v", name, bucketUuid, err)
+		return IPNS{}, err
+	}
+
+	log.Printf("IPNS record %s created successfully in bucket %s: %s", record.IPNSUUID, bucketUuid, res)
+	return record, nil
+}
+
+// ListIPNS lists one page of the IPNS records of a bucket, filtered and ordered by opts.
+// Returns a ListIPNSResponse or an error if the request or unmarshalling fails.
+func ListIPNS(bucketUuid string, opts ListIPNSOptions) (ListIPNSResponse, error) {
+	if bucketUuid == "" {
+		return ListIPNSResponse{}, fmt.Errorf("bucket uuid is required")
+	}
+
+	res, err := requests.GetReq("/storage/buckets/"+bucketUuid+"/ipns", opts.params())
+	if err != nil {
+		log.Printf("Failed to list IPNS records in bucket %s: %v", bucketUuid, err)
+		return ListIPNSResponse{}, err
+	}
+
+	var records ListIPNSResponse
+	if errUnmarshal := json.Unmarshal([]byte(res), &records); errUnmarshal != nil {
+		log.Printf("Failed to unmarshal JSON response from list IPNS records in bucket %s: %v. Raw response: %s", bucketUuid, errUnmarshal, res)
+		return ListIPNSResponse{}, fmt.Errorf("failed to unmarshal list IPNS response: %w. Raw response: %s", errUnmarshal, res)
+	}
+	if records.Status >= 400 {
+		return ListIPNSResponse{}, fmt.Errorf("list IPNS returned status %d: %s", records.Status, res)
+	}
+
+	log.Printf("Listed %d of %d IPNS records in bucket %s", len(records.Data.Items), records.Data.Total, bucketUuid)
+	return records, nil
+}
+
+// GetIPNS retrieves an IPNS record of a bucket by its UUID.
+// Returns the record, or an error if the request fails or the API returns an error.
+func GetIPNS(bucketUuid string, ipnsUuid string) (IPNS, error) {
+	if bucketUuid == "" || ipnsUuid == "" {
+		return IPNS{}, fmt.Errorf("bucket uuid and ipns uuid are required")
+	}
+
+	res, err := requests.GetReq("/storage/buckets/"+bucketUuid+"/ipns/"+ipnsUuid, nil)
+	if err != nil {
+		log.Printf("Failed to get IPNS record %s in bucket %s: %v", ipnsUuid, bucketUuid, err)
+		return IPNS{}, err
+	}
+
+	record, err := decodeResponse[IPNS](res, "get IPNS")
+	if err != nil {
+		log.Printf("Failed to get IPNS record %s in bucket %s: %v", ipnsUuid, bucketUuid, err)
+		return IPNS{}, err
+	}
+
+	log.Printf("IPNS record details: %s", res)
+	return record, nil
+}
+
+// DeleteIPNS deletes an IPNS record of a bucket. The content it pointed to is not affected.
+// Returns the deleted record, or an error if the request fails or the API returns an error.
+func DeleteIPNS(bucketUuid string, ipnsUuid string) (IPNS, error) {
+	if bucketUuid == "" || ipnsUuid == "" {
+		return IPNS{}, fmt.Errorf("bucket uuid and ipns uuid are required")
+	}
+
+	res, err := requests.DeleteReq("/storage/buckets/" + bucketUuid + "/ipns/" + ipnsUuid)
+	if err != nil {
+		log.Printf("Failed to delete IPNS record %s in bucket %s: %v", ipnsUuid, bucketUuid, err)
+		return IPNS{}, err
+	}
+
+	record, err := decodeResponse[IPNS](res, "delete IPNS")
+	if err != nil {
+		log.Printf("Failed to delete IPNS record %s in bucket %s: %v", ipnsUuid, bucketUuid, err)
+		return IPNS{}, err
+	}
+
+	log.Printf("IPNS record %s deleted successfully from bucket %s: %s", ipnsUuid, bucketUuid, res)
+	return record, nil
+}
+
+// PublishIPNS points an IPNS record at the content with the given CID.
+// Returns the updated record, or an error if the CID is invalid or the request fails.
+func PublishIPNS(bucketUuid string, ipnsUuid string, contentCid string) (IPNS, error) {
+	if bucketUuid == "" || ipnsUuid == "" {
+		return IPNS{}, fmt.Errorf("bucket uuid and ipns uuid are required")
+	}
+	if _, err := cid.Parse(contentCid); err != nil {
+		return IPNS{}, fmt.Errorf("invalid CID %q: %w", contentCid, err)
+	}
+
+	bodyBytes, err := json.Marshal(publishIPNSRequest{CID: contentCid})
+	if err != nil {
+		log.Printf("Failed to marshal publish IPNS request for record %s: %v", ipnsUuid, err)
+		return IPNS{}, err
+	}
+
+	path := "/storage/buckets/" + bucketUuid + "/ipns/" + ipnsUuid + "/publish"
+	res, err := requests.PostReq(path, strings.NewReader(string(bodyBytes)))
+	if err != nil {
+		log.Printf("Failed to publish %s to IPNS record %s in bucket %s: %v", contentCid, ipnsUuid, bucketUuid, err)
+		return IPNS{}, err
+	}
+
+	record, err := decodeResponse[IPNS](res, "publish IPNS")
+	if err != nil {
+		log.Printf("Failed to publish %s to IPNS record %s in bucket %s: %v", contentCid, ipnsUuid, bucketUuid, err)
+		return IPNS{}, err
+	}
+
+	log.Printf("Published %s to IPNS record %s in bucket %s", contentCid, ipnsUuid, bucketUuid)
+	return record, nil
+}
+
+// PublishResult describes the outcome of UploadDirectoryAndPublish.
+type PublishResult struct {
+	Upload UploadResult // Result of the directory upload
+	CID    string       // CID of the uploaded directory that was published
+	IPNS   IPNS         // IPNS record after publishing
+}
+
+// UploadDirectoryAndPublish uploads localDir to opts.RemotePath in a bucket, waits for Apillon to
+// process the files and give the directory a CID, then publishes that CID to the IPNS record
+// ipnsUuid. opts.RemotePath is required because only directories, not the bucket root, have a CID.
+// When the directory already exists, its CID from before the upload is not published again: the
+// wait lasts until the CID changes, unless that CID already matches the CID of localDir computed
+// locally. wait bounds both the wait for the files and the wait for the directory CID.
+// Returns the upload result with the published CID and record, or the error of the first step that failed.
+func UploadDirectoryAndPublish(localDir string, bucketUuid string, ipnsUuid string, opts DirectoryOptions, wait WaitOptions) (PublishResult, error) {
+	if ipnsUuid == "" {
+		return PublishResult{}, fmt.Errorf("ipns uuid is required")
+	}
+	remotePath := strings.Trim(opts.RemotePath, "/")
+	if remotePath == "" {
+		return PublishResult{}, fmt.Errorf("remote path is required to publish a directory")
+	}
+
+	previous, err := directoryCID(bucketUuid, remotePath)
+	if err != nil {
+		return PublishResult{}, err
+	}
+
+	upload, err := UploadDirectory(localDir, bucketUuid, opts)
+	result := PublishResult{Upload: upload}
+	if err != nil {
+		return result, err
+	}
+
+	sessions := map[string]bool{}
+	for _, f := range upload.Files {
+		if f.SessionUUID != "" && !sessions[f.SessionUUID] {
+			sessions[f.SessionUUID] = true
+			if _, err := WaitForFiles(bucketUuid, f.SessionUUID, nil, wait); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if previous != "" && directoryMatches(localDir, previous) {
+		log.Printf("Directory %s in bucket %s is unchanged with CID %s", remotePath, bucketUuid, previous)
+		result.CID = previous
+	} else if result.CID, err = waitForDirectoryCID(bucketUuid, remotePath, previous, wait); err != nil {
+		return result, err
+	}
+	result.IPNS, err = PublishIPNS(bucketUuid, ipnsUuid, result.CID)
+	return result, err
+}
+
+// waitForDirectoryCID polls the parent of the directory at dirPath until Apillon reports a CID for
+// it other than previous, the CID the directory had before the upload.
+func waitForDirectoryCID(bucketUuid string, dirPath string, previous string, opts WaitOptions) (string, error) {
+	opts = opts.withDefaults()
+	deadline := time.Now().Add(opts.Timeout)
+	interval := opts.InitialInterval
+
+	for {
+		dirCid, err := directoryCID(bucketUuid, dirPath)
+		if err != nil {
+			return "", err
+		}
+		if dirCid != "" && dirCid != previous {
+			return dirCid, nil
+		}
+
+		log.Printf("Waiting for the CID of directory %s in bucket %s", dirPath, bucketUuid)
+		if !sleepUntilNextPoll(deadline, interval) {
+			return "", fmt.Errorf("timed out waiting for the CID of directory %s in bucket %s", dirPath, bucketUuid)
+		}
+		interval = min(interval*2, opts.MaxInterval)
+	}
+}
+
+// directoryCID returns the CID Apillon reports for the directory at dirPath, or "" if the directory
+// does not exist or has no CID yet.
+func directoryCID(bucketUuid string, dirPath string) (string, error) {
+	items, err := ListDirectoryByPath(bucketUuid, path.Dir(dirPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	item, _ := findContentItem(items, path.Base(dirPath))
+	return item.CID, nil
+}
+
+// directoryMatches reports whether remoteCid is the CID of localDir, computed like `ipfs add -r`.
+func directoryMatches(localDir string, remoteCid string) bool {
+	remote, err := cid.Parse(remoteCid)
+	if err != nil {
+		return false
+	}
+	v0, err := cid.FromDirectory(localDir, cid.V0())
+	if err != nil {
+		return false
+	}
+	v1, err := cid.FromDirectory(localDir, cid.V1())
+	if err != nil {
+		return false
+	}
+	return cidMatches(remote, v0, v1)
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func ipnsJSON(uuid string, value string) map[string]any {
+	return map[string]any{"ipnsUuid": uuid, "name": "site", "ipnsName": "k51test", "ipnsValue": value, "link": "https://ipns.example.com/k51test"}
+}
+
+func TestCreateAndPublishIPNS(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	contentCID := testCID(t, "v1 of the site")
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/ipns").
+		MatchType("json").
+		JSON(map[string]string{"name": "site"}).
+		Reply(201).
+		JSON(map[string]any{"status": 201, "data": ipnsJSON("ipns-1", "")})
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/ipns/ipns-1/publish").
+		MatchType("json").
+		JSON(map[string]string{"cid": contentCID}).
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": ipnsJSON("ipns-1", "/ipfs/"+contentCID)})
+
+	record, err := CreateIPNS(bucketUUID, "site", "", "")
+	if err != nil || record.IPNSUUID != "ipns-1" {
+		t.Fatalf("CreateIPNS = %+v, %v", record, err)
+	}
+	record, err = PublishIPNS(bucketUUID, "ipns-1", contentCID)
+	if err != nil || record.IPNSValue != "/ipfs/"+contentCID {
+		t.Errorf("PublishIPNS = %+v, %v", record, err)
+	}
+	if !gock.IsDone() {
+		t.Error("expected both requests to be sent")
+	}
+
+	if _, err := PublishIPNS(bucketUUID, "ipns-1", "not-a-cid"); err == nil {
+		t.Error("expected an error for an invalid CID")
+	}
+}
+
+func TestListIPNS(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/"+bucketUUID+"/ipns").
+		MatchParam("search", "^site$").
+		MatchParam("page", "^2$").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"total": 3, "items": []map[string]any{ipnsJSON("ipns-3", "")}}})
+
+	records, err := ListIPNS(bucketUUID, ListIPNSOptions{Search: "site", Page: 2})
+	if err != nil || len(records.Data.Items) != 1 || records.Data.Total != 3 {
+		t.Errorf("ListIPNS = %+v, %v", records, err)
+	}
+}
+
+// mockPublishUpload mocks the upload of index.html to the site directory and its processing.
+func mockPublishUpload(t *testing.T, bucketUUID string) {
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload$").
+		Reply(200).
+		JSON(map[string]any{"data": map[string]any{
+			"sessionUuid": "session-1",
+			"files":       []map[string]any{{"fileName": "index.html", "path": "site", "url": "https://s3.example.com/index", "fileUuid": "file-index"}},
+		}})
+	gock.New("https://s3.example.com").Put("/index").Reply(200)
+	gock.New("https://api.apillon.io").Post("/upload/session-1/end").Reply(200).JSON(map[string]any{"data": true})
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/" + bucketUUID + "/upload/session-1/files").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"total": 1, "items": []map[string]any{
+			{"fileUuid": "file-index", "fileStatus": 4, "CID": testCID(t, "<h1>hello</h1>")},
+		}}})
+}
+
+func TestUploadDirectoryAndPublish(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"index.html": "<h1>hello</h1>"})
+	dirCID := testCID(t, "directory")
+
+	// The directory does not exist before the upload and has no CID on the first poll
+	mockContent(bucketUUID, "", []map[string]any{})
+	mockPublishUpload(t, bucketUUID)
+	mockContent(bucketUUID, "", []map[string]any{{"type": 1, "uuid": "dir-site", "name": "site"}})
+	mockContent(bucketUUID, "", []map[string]any{{"type": 1, "uuid": "dir-site", "name": "site", "CID": dirCID}})
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/ipns/ipns-1/publish").
+		MatchType("json").
+		JSON(map[string]string{"cid": dirCID}).
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": ipnsJSON("ipns-1", "/ipfs/"+dirCID)})
+
+	result, err := UploadDirectoryAndPublish(dir, bucketUUID, "ipns-1", DirectoryOptions{RemotePath: "/site/"}, fastWait)
+	if err != nil {
+		t.Fatalf("UploadDirectoryAndPublish returned error: %v", err)
+	}
+	if result.CID != dirCID || result.IPNS.IPNSValue != "/ipfs/"+dirCID || len(result.Upload.Files) != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if !gock.IsDone() {
+		t.Error("expected every step to run")
+	}
+
+	if _, err := UploadDirectoryAndPublish(dir, bucketUUID, "ipns-1", DirectoryOptions{}, fastWait); err == nil {
+		t.Error("expected an error without a remote path")
+	}
+}
+
+func TestUploadDirectoryAndPublish_WaitsForNewCID(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"index.html": "<h1>hello</h1>"})
+	oldCID, newCID := testCID(t, "old directory"), testCID(t, "new directory")
+
+	// The directory keeps the CID of the previous upload until Apillon processes the new files
+	mockContent(bucketUUID, "", []map[string]any{{"type": 1, "uuid": "dir-site", "name": "site", "CID": oldCID}})
+	mockPublishUpload(t, bucketUUID)
+	mockContent(bucketUUID, "", []map[string]any{{"type": 1, "uuid": "dir-site", "name": "site", "CID": oldCID}})
+	mockContent(bucketUUID, "", []map[string]any{{"type": 1, "uuid": "dir-site", "name": "site", "CID": newCID}})
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/ipns/ipns-1/publish").
+		MatchType("json").
+		JSON(map[string]string{"cid": newCID}).
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": ipnsJSON("ipns-1", "/ipfs/"+newCID)})
+
+	result, err := UploadDirectoryAndPublish(dir, bucketUUID, "ipns-1", DirectoryOptions{RemotePath: "site"}, fastWait)
+	if err != nil {
+		t.Fatalf("UploadDirectoryAndPublish returned error: %v", err)
+	}
+	if result.CID != newCID {
+		t.Errorf("published %s, want the new CID %s", result.CID, newCID)
+	}
+	if !gock.IsDone() {
+		t.Error("expected every step to run")
+	}
+}
+
+func TestUploadDirectoryAndPublish_UnchangedDirectory(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"index.html": "<h1>hello</h1>"})
+	dirCID, err := cid.FromDirectory(dir, cid.V1())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-uploading the same content keeps the CID, which is published without waiting for a change
+	mockContent(bucketUUID, "", []map[string]any{{"type": 1, "uuid": "dir-site", "name": "site", "CID": dirCID.String()}})
+	mockPublishUpload(t, bucketUUID)
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/ipns/ipns-1/publish").
+		MatchType("json").
+		JSON(map[string]string{"cid": dirCID.String()}).
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": ipnsJSON("ipns-1", "/ipfs/"+dirCID.String())})
+
+	result, err := UploadDirectoryAndPublish(dir, bucketUUID, "ipns-1", DirectoryOptions{RemotePath: "site"}, fastWait)
+	if err != nil {
+		t.Fatalf("UploadDirectoryAndPublish returned error: %v", err)
+	}
+	if result.CID != dirCID.String() || !gock.IsDone() {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJournalURLTTL is how long signed URLs recorded in an upload journal are trusted
+// before the session is considered expired and a new one is started.
+const DefaultJournalURLTTL = 1 * time.Hour
+
+// uploadJournal records the progress of an upload so an interrupted process can resume it.
+// Files[i] always describes the i-th file passed to the upload orchestrator.
+// Mutating methods are safe for concurrent use by sessions uploading in parallel.
+type uploadJournal struct {
+	path string
+	mu   sync.Mutex
+
+	BucketUUID string           `json:"bucketUuid"` // Bucket the files are uploaded to
+	Sessions   []journalSession `json:"sessions"`   // Upload sessions started for these files
+	Files      []journalFile    `json:"files"`      // Per-file progress
+}
+
+// journalSession describes an upload session started by the orchestrator.
+type journalSession struct {
+	SessionUUID string    `json:"sessionUuid"` // Unique identifier for the session
+	StartedAt   time.Time `json:"startedAt"`   // When the signed URLs were issued
+	Ended       bool      `json:"ended"`       // Whether EndSession completed for this session
+}
+
+// journalFile records the upload state of a single file.
+type journalFile struct {
+	FileName    string `json:"fileName"`              // Name of the file
+	Path        string `json:"path,omitempty"`        // Virtual directory of the file
+	Size        int64  `json:"size"`                  // Size of the content in bytes
+	SHA256      string `json:"sha256"`                // Hex-encoded SHA-256 of the content
+	SessionUUID string `json:"sessionUuid,omitempty"` // Session the file is assigned to
+	URL         string `json:"url,omitempty"`         // Signed URL issued for the file
+	FileUUID    string `json:"fileUuid,omitempty"`    // Unique identifier assigned by Apillon
+	Done        bool   `json:"done"`                  // Whether the content was uploaded
+}
+
+// newJournal creates an empty journal for the given files. The journal is only
+// persisted when path is not empty.
+func newJournal(path string, bucketUuid string, files []WholeFile) *uploadJournal {
+	j := &uploadJournal{
+		path:       path,
+		BucketUUID: bucketUuid,
+		Files:      make([]journalFile, len(files)),
+	}
+	for i, file := range files {
+		sum := sha256.Sum256([]byte(file.Content))
+		j.Files[i] = journalFile{
+			FileName: file.Metadata.FileName,
+			Path:     file.Metadata.Path,
+			Size:     int64(len(file.Content)),
+			SHA256:   hex.EncodeToString(sum[:]),
+		}
+	}
+	return j
+}
+
+// openJournal loads the journal at path when it describes the same bucket and files,
+// otherwise it returns a fresh journal. An empty path yields an in-memory journal.
+func openJournal(path string, bucketUuid string, files []WholeFile) (*uploadJournal, error) {
+	fresh := newJournal(path, bucketUuid, files)
+	if path == "" {
+		return fresh, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload journal %s: %w", path, err)
+	}
+
+	var saved uploadJournal
+	if errUnmarshal := json.Unmarshal(data, &saved); errUnmarshal != nil {
+		log.Printf("Ignoring unreadable upload journal %s: %v", path, errUnmarshal)
+		return fresh, nil
+	}
+	if !saved.matches(fresh) {
+		log.Printf("Upload journal %s describes a different upload, starting over", path)
+		return fresh, nil
+	}
+
+	saved.path = path
+	log.Printf("Resuming upload for bucket %s from journal %s", bucketUuid, path)
+	return &saved, nil
+}
+
+// matches reports whether j was recorded for the same bucket and file contents as other.
+func (j *uploadJournal) matches(other *uploadJournal) bool {
+	if j.BucketUUID != other.BucketUUID || len(j.Files) != len(other.Files) {
+		return false
+	}
+	for i := range j.Files {
+		a, b := j.Files[i], other.Files[i]
+		if a.FileName != b.FileName || a.Path != b.Path || a.Size != b.Size || a.SHA256 != b.SHA256 {
+			return false
+		}
+	}
+	return true
+}
+
+// session returns the journal entry for the given session UUID, or nil.
+func (j *uploadJournal) session(sessionUuid string) *journalSession {
+	for i := range j.Sessions {
+		if j.Sessions[i].SessionUUID == sessionUuid {
+			return &j.Sessions[i]
+		}
+	}
+	return nil
+}
+
+// openSessions returns the UUIDs of sessions that have not been ended yet.
+func (j *uploadJournal) openSessions() []string {
+	var open []string
+	for _, s := range j.Sessions {
+		if !s.Ended {
+			open = append(open, s.SessionUUID)
+		}
+	}
+	return open
+}
+
+// filesInSession returns the indexes of files assigned to the given session.
+func (j *uploadJournal) filesInSession(sessionUuid string) []int {
+	var idx []int
+	for i, f := range j.Files {
+		if f.SessionUUID == sessionUuid {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// unassigned returns the indexes of files that still need a session.
+func (j *uploadJournal) unassigned() []int {
+	var idx []int
+	for i, f := range j.Files {
+		if !f.Done && f.SessionUUID == "" {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// assign records a newly started session and the signed URLs issued for the files at idx, which were
+// requested with metadata in the same order. Signed URLs are matched to files by name and path, since
+// the API does not guarantee their order.
+// Returns an error if a file has no signed URL or several files share the same name and path.
+func (j *uploadJournal) assign(data Session, idx []int, metadata []FileMetadata) error {
+	if len(data.Files) < len(idx) {
+		return fmt.Errorf("not enough URLs provided for the number of files. Expected %d URLs, got %d", len(idx), len(data.Files))
+	}
+
+	items := make(map[string]FileItem, len(data.Files))
+	for _, item := range data.Files {
+		itemPath := ""
+		if item.Path != nil {
+			itemPath = *item.Path
+		}
+		key := sessionFileKey(itemPath, item.FileName)
+		if _, ok := items[key]; ok {
+			return fmt.Errorf("duplicate signed URL for file %s in session %s", key, data.SessionUUID)
+		}
+		items[key] = item
+	}
+
+	matched := make([]FileItem, len(idx))
+	requested := make(map[string]bool, len(idx))
+	for n, meta := range metadata {
+		key := sessionFileKey(meta.Path, meta.FileName)
+		if requested[key] {
+			return fmt.Errorf("duplicate file %s in session %s", key, data.SessionUUID)
+		}
+		requested[key] = true
+		item, ok := items[key]
+		if !ok {
+			return fmt.Errorf("no signed URL for file %s in session %s", key, data.SessionUUID)
+		}
+		matched[n] = item
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Sessions = append(j.Sessions, journalSession{SessionUUID: data.SessionUUID, StartedAt: time.Now()})
+	for n, i := range idx {
+		j.Files[i].SessionUUID = data.SessionUUID
+		j.Files[i].URL = matched[n].URL
+		j.Files[i].FileUUID = matched[n].FileUUID
+	}
+	return j.saveLocked()
+}
+
+// sessionFileKey identifies a file of an upload session by its path and name.
+func sessionFileKey(filePath string, fileName string) string {
+	return path.Join(strings.Trim(filePath, "/"), fileName)
+}
+
+// markDone records that the file at index i was uploaded.
+func (j *uploadJournal) markDone(i int) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Files[i].Done = true
+	return j.saveLocked()
+}
+
+// committed reports whether the file at index i was uploaded and its session ended.
+func (j *uploadJournal) committed(i int) bool {
+	s := j.session(j.Files[i].SessionUUID)
+	return j.Files[i].Done && s != nil && s.Ended
+}
+
+// markEnded records that a session was ended, or abandoned when release is set. Abandoned
+// sessions release their unfinished files so they are assigned to a new session.
+func (j *uploadJournal) markEnded(sessionUuid string, release bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if s := j.session(sessionUuid); s != nil {
+		s.Ended = true
+	}
+	if release {
+		for i := range j.Files {
+			if j.Files[i].SessionUUID == sessionUuid && !j.Files[i].Done {
+				j.Files[i].SessionUUID = ""
+				j.Files[i].URL = ""
+				j.Files[i].FileUUID = ""
+			}
+		}
+	}
+	return j.saveLocked()
+}
+
+// saveLocked writes the journal to disk atomically. It is a no-op for in-memory journals.
+// The caller must hold j.mu.
+func (j *uploadJournal) saveLocked() error {
+	if j.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload journal: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write upload journal %s: %w", j.path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write upload journal %s: %w", j.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write upload journal %s: %w", j.path, err)
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write upload journal %s: %w", j.path, err)
+	}
+	return nil
+}
+
+// remove deletes the journal from disk once the upload has completed.
+func (j *uploadJournal) remove() {
+	if j.path == "" {
+		return
+	}
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove upload journal %s: %v", j.path, err)
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func writeTestJournal(t *testing.T, path string, j *uploadJournal) {
+	t.Helper()
+	data, err := json.Marshal(j)
+	if err != nil {
+		t.Fatalf("failed to marshal journal: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write journal: %v", err)
+	}
+}
+
+func TestUploadFileProcessWithOptions_ResumesJournal(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "a.txt"}, Content: "first"},
+		{Metadata: FileMetadata{FileName: "b.txt"}, Content: "second"},
+	}
+
+	journalPath := filepath.Join(t.TempDir(), "upload.journal")
+	j := newJournal(journalPath, bucketUUID, files)
+	j.Sessions = []journalSession{{SessionUUID: "session-1", StartedAt: time.Now()}}
+	j.Files[0].SessionUUID, j.Files[0].URL, j.Files[0].Done = "session-1", "https://s3.example.com/a", true
+	j.Files[1].SessionUUID, j.Files[1].URL = "session-1", "https://s3.example.com/b"
+	writeTestJournal(t, journalPath, j)
+
+	// Only the missing file is uploaded and the recorded session is ended
+	gock.New("https://s3.example.com").Put("/b").Reply(200)
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload/session-1/end").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+
+	if _, err := UploadFileProcessWithOptions(bucketUUID, files, UploadOptions{JournalPath: journalPath}); err != nil {
+		t.Fatalf("UploadFileProcessWithOptions returned error: %v", err)
+	}
+	if !gock.IsDone() {
+		t.Fatalf("expected HTTP requests were not made")
+	}
+	if _, err := os.Stat(journalPath); !os.IsNotExist(err) {
+		t.Errorf("journal should be removed after a successful upload, stat error: %v", err)
+	}
+}
+
+func TestUploadFileProcessWithOptions_ExpiredJournal(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "a.txt"}, Content: "first"},
+		{Metadata: FileMetadata{FileName: "b.txt"}, Content: "second"},
+	}
+
+	journalPath := filepath.Join(t.TempDir(), "upload.journal")
+	j := newJournal(journalPath, bucketUUID, files)
+	j.Sessions = []journalSession{{SessionUUID: "session-1", StartedAt: time.Now().Add(-2 * time.Hour)}}
+	j.Files[0].SessionUUID, j.Files[0].URL, j.Files[0].Done = "session-1", "https://s3.example.com/a", true
+	j.Files[1].SessionUUID, j.Files[1].URL = "session-1", "https://s3.example.com/b-expired"
+	writeTestJournal(t, journalPath, j)
+
+	// The expired session is ended to commit a.txt, then b.txt gets a new session
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload/session-1/end").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload$").
+		BodyString(`"fileName":"b.txt"`).
+		Reply(200).
+		JSON(map[string]any{
+			"data": map[string]any{
+				"sessionUuid": "session-2",
+				"files":       []map[string]any{{"fileName": "b.txt", "url": "https://s3.example.com/b-fresh"}},
+			},
+		})
+	gock.New("https://s3.example.com").Put("/b-fresh").Reply(200)
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload/session-2/end").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+
+	if _, err := UploadFileProcessWithOptions(bucketUUID, files, UploadOptions{JournalPath: journalPath}); err != nil {
+		t.Fatalf("UploadFileProcessWithOptions returned error: %v", err)
+	}
+	if !gock.IsDone() {
+		t.Fatalf("expected HTTP requests were not made")
+	}
+}
+
+func TestOpenJournal_IgnoresDifferentFiles(t *testing.T) {
+	bucketUUID := "test-bucket-uuid"
+	journalPath := filepath.Join(t.TempDir(), "upload.journal")
+
+	old := newJournal(journalPath, bucketUUID, []WholeFile{{Metadata: FileMetadata{FileName: "a.txt"}, Content: "old"}})
+	old.Sessions = []journalSession{{SessionUUID: "session-1", StartedAt: time.Now()}}
+	writeTestJournal(t, journalPath, old)
+
+	j, err := openJournal(journalPath, bucketUUID, []WholeFile{{Metadata: FileMetadata{FileName: "a.txt"}, Content: "new"}})
+	if err != nil {
+		t.Fatalf("openJournal returned error: %v", err)
+	}
+	if len(j.Sessions) != 0 {
+		t.Errorf("expected a fresh journal for changed content, got sessions %+v", j.Sessions)
+	}
+}
+
+func TestUploadJournalAssign(t *testing.T) {
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "a.txt", Path: "docs"}, Content: "a"},
+		{Metadata: FileMetadata{FileName: "a.txt"}, Content: "root a"},
+	}
+	metadata := []FileMetadata{files[0].Metadata, files[1].Metadata}
+	docs := "docs/"
+	item := func(p *string, url string) FileItem {
+		return FileItem{Path: p, FileName: "a.txt", URL: url, FileUUID: url}
+	}
+
+	// Signed URLs returned in a different order still go to the right files
+	j := newJournal("", "test-bucket-uuid", files)
+	session := Session{SessionUUID: "session-1", Files: []FileItem{item(nil, "root"), item(&docs, "docs")}}
+	if err := j.assign(session, []int{0, 1}, metadata); err != nil {
+		t.Fatalf("assign returned error: %v", err)
+	}
+	if j.Files[0].URL != "docs" || j.Files[1].URL != "root" || j.Files[0].FileUUID != "docs" {
+		t.Errorf("signed URLs assigned to the wrong files: %+v", j.Files)
+	}
+
+	for name, items := range map[string][]FileItem{
+		"missing":   {item(nil, "root"), {FileName: "b.txt", URL: "b"}},
+		"duplicate": {item(nil, "root"), item(nil, "again")},
+	} {
+		j := newJournal("", "test-bucket-uuid", files)
+		if err := j.assign(Session{SessionUUID: "session-1", Files: items}, []int{0, 1}, metadata); err == nil {
+			t.Errorf("%s entry: expected an error", name)
+		}
+		if j.Files[0].URL != "" || len(j.Sessions) != 0 {
+			t.Errorf("%s entry: journal was modified: %+v", name, j)
+		}
+	}
+}
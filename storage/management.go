@@ -3,34 +3,85 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"iter"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/LeonardoRyuta/apillon-storage/requests"
 )
 
+// ListBucketsOptions filters, orders and paginates the buckets listed by ListBuckets.
+// The zero value lists the first page with the API's defaults.
+type ListBucketsOptions struct {
+	Search  string // Only buckets whose name contains this text
+	Page    int    // Page to list, starting at 1
+	Limit   int    // Number of buckets per page
+	OrderBy string // Field to order by, e.g. "name" or "createTime"
+	Desc    bool   // Order descending instead of ascending
+}
+
+// params returns the query parameters for the options.
+func (o ListBucketsOptions) params() map[string]string {
+	params := map[string]string{}
+	if o.Search != "" {
+		params["search"] = o.Search
+	}
+	if o.Page > 0 {
+		params["page"] = strconv.Itoa(o.Page)
+	}
+	if o.Limit > 0 {
+		params["limit"] = strconv.Itoa(o.Limit)
+	}
+	if o.OrderBy != "" {
+		params["orderBy"] = o.OrderBy
+	}
+	if o.Desc {
+		params["desc"] = "true"
+	}
+	return params
+}
+
+// BucketUpdate holds the bucket fields changed by UpdateBucket. Nil fields are left unchanged.
+type BucketUpdate struct {
+	Name        *string `json:"name,omitempty"`        // New name of the bucket
+	Description *string `json:"description,omitempty"` // New description of the bucket; an empty string clears it
+}
+
+// createBucketRequest is the body sent to create a bucket.
+type createBucketRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
 // CreateBucket creates a new storage bucket with the specified name and optional description.
 // Sends a POST request to the storage API to create the bucket.
-// Returns an error if the request fails or the API returns an error.
-func CreateBucket(name string, description string) error {
+// Returns the created bucket, or an error if the request fails or the API returns an error.
+func CreateBucket(name string, description string) (BucketItem, error) {
 	if name == "" {
-		return fmt.Errorf("bucket name is required")
+		return BucketItem{}, fmt.Errorf("bucket name is required")
 	}
 
-	body := `{"name":"` + name + `"`
-	if description != "" {
-		body += `, "description":"` + description + `"`
+	bodyBytes, err := json.Marshal(createBucketRequest{Name: name, Description: description})
+	if err != nil {
+		log.Printf("Failed to marshal create bucket request: %v", err)
+		return BucketItem{}, err
 	}
-	body += `}`
 
-	res, err := requests.PostReq("/storage/buckets", strings.NewReader(body))
+	res, err := requests.PostReq("/storage/buckets", strings.NewReader(string(bodyBytes)))
 	if err != nil {
 		log.Printf("Failed to create bucket: %v", err)
-		return err
+		return BucketItem{}, err
 	}
 
-	log.Printf("Bucket created successfully: %s", res)
-	return nil
+	bucket, err := decodeResponse[BucketItem](res, "create bucket")
+	if err != nil {
+		log.Printf("Failed to create bucket %s: %v", name, err)
+		return BucketItem{}, err
+	}
+
+	log.Printf("Bucket %s created successfully: %s", bucket.BucketUUID, res)
+	return bucket, nil
 }
 
 // GetBucket retrieves information about storage buckets, optionally filtered by name.
@@ -59,3 +110,152 @@ func GetBucket(name string) (ListBucketsResponse, error) {
 	log.Printf("Bucket details: %s", res)
 	return bucketList, nil
 }
+
+// GetBucketByUUID retrieves a single bucket by its UUID.
+// Returns the bucket, or an error if the request fails or the API returns an error.
+func GetBucketByUUID(bucketUuid string) (BucketItem, error) {
+	if bucketUuid == "" {
+		return BucketItem{}, fmt.Errorf("bucket uuid is required")
+	}
+
+	res, err := requests.GetReq("/storage/buckets/"+bucketUuid, nil)
+	if err != nil {
+		log.Printf("Failed to get bucket %s: %v", bucketUuid, err)
+		return BucketItem{}, err
+	}
+
+	bucket, err := decodeResponse[BucketItem](res, "get bucket")
+	if err != nil {
+		log.Printf("Failed to get bucket %s: %v", bucketUuid, err)
+		return BucketItem{}, err
+	}
+
+	log.Printf("Bucket details: %s", res)
+	return bucket, nil
+}
+
+// UpdateBucket changes the name and/or description of a bucket.
+// Returns the updated bucket, or an error if the request fails or the API returns an error.
+func UpdateBucket(bucketUuid string, update BucketUpdate) (BucketItem, error) {
+	if bucketUuid == "" {
+		return BucketItem{}, fmt.Errorf("bucket uuid is required")
+	}
+	if update.Name == nil && update.Description == nil {
+		return BucketItem{}, fmt.Errorf("nothing to update")
+	}
+	if update.Name != nil && *update.Name == "" {
+		return BucketItem{}, fmt.Errorf("bucket name cannot be empty")
+	}
+
+	bodyBytes, err := json.Marshal(update)
+	if err != nil {
+		log.Printf("Failed to marshal update bucket request for bucket %s: %v", bucketUuid, err)
+		return BucketItem{}, err
+	}
+
+	res, err := requests.PatchReq("/storage/buckets/"+bucketUuid, strings.NewReader(string(bodyBytes)))
+	if err != nil {
+		log.Printf("Failed to update bucket %s: %v", bucketUuid, err)
+		return BucketItem{}, err
+	}
+
+	bucket, err := decodeResponse[BucketItem](res, "update bucket")
+	if err != nil {
+		log.Printf("Failed to update bucket %s: %v", bucketUuid, err)
+		return BucketItem{}, err
+	}
+
+	log.Printf("Bucket %s updated successfully: %s", bucketUuid, res)
+	return bucket, nil
+}
+
+// DeleteBucket marks a bucket for deletion. Apillon removes the bucket and its files after a grace period.
+// Returns the deleted bucket, or an error if the request fails or the API returns an error.
+func DeleteBucket(bucketUuid string) (BucketItem, error) {
+	if bucketUuid == "" {
+		return BucketItem{}, fmt.Errorf("bucket uuid is required")
+	}
+
+	res, err := requests.DeleteReq("/storage/buckets/" + bucketUuid)
+	if err != nil {
+		log.Printf("Failed to delete bucket %s: %v", bucketUuid, err)
+		return BucketItem{}, err
+	}
+
+	bucket, err := decodeResponse[BucketItem](res, "delete bucket")
+	if err != nil {
+		log.Printf("Failed to delete bucket %s: %v", bucketUuid, err)
+		return BucketItem{}, err
+	}
+
+	log.Printf("Bucket %s deleted successfully: %s", bucketUuid, res)
+	return bucket, nil
+}
+
+// ListBuckets lists one page of the project's buckets, filtered and ordered by opts.
+// Use IterateBuckets to walk every page.
+// Returns a ListBucketsResponse or an error if the request or unmarshalling fails.
+func ListBuckets(opts ListBucketsOptions) (ListBucketsResponse, error) {
+	res, err := requests.GetReq("/storage/buckets", opts.params())
+	if err != nil {
+		log.Printf("Failed to list buckets: %v", err)
+		return ListBucketsResponse{}, err
+	}
+
+	var bucketList ListBucketsResponse
+	if errUnmarshal := json.Unmarshal([]byte(res), &bucketList); errUnmarshal != nil {
+		log.Printf("Failed to unmarshal JSON response from list buckets: %v. Raw response: %s", errUnmarshal, res)
+		return ListBucketsResponse{}, fmt.Errorf("failed to unmarshal list buckets response: %w. Raw response: %s", errUnmarshal, res)
+	}
+	if bucketList.Status >= 400 {
+		return ListBucketsResponse{}, fmt.Errorf("list buckets returned status %d: %s", bucketList.Status, res)
+	}
+
+	log.Printf("Listed %d of %d buckets", len(bucketList.Data.Items), bucketList.Data.Total)
+	return bucketList, nil
+}
+
+// IterateBuckets returns an iterator over every bucket matching opts, fetching pages of
+// opts.Limit buckets (DefaultListPageSize if unset) as the loop advances, starting at opts.Page.
+// A failed request is yielded as an error and ends the iteration.
+func IterateBuckets(opts ListBucketsOptions) iter.Seq2[BucketItem, error] {
+	return func(yield func(BucketItem, error) bool) {
+		if opts.Page <= 0 {
+			opts.Page = 1
+		}
+		if opts.Limit <= 0 {
+			opts.Limit = DefaultListPageSize
+		}
+
+		for {
+			resp, err := ListBuckets(opts)
+			if err != nil {
+				yield(BucketItem{}, err)
+				return
+			}
+			for _, bucket := range resp.Data.Items {
+				if !yield(bucket, nil) {
+					return
+				}
+			}
+			if len(resp.Data.Items) < opts.Limit || opts.Page*opts.Limit >= resp.Data.Total {
+				return
+			}
+			opts.Page++
+		}
+	}
+}
+
+// decodeResponse decodes the data of a response of the named operation,
+// returning an error for error statuses.
+func decodeResponse[T any](res string, op string) (T, error) {
+	var resp APIResponse[T]
+	var zero T
+	if errUnmarshal := json.Unmarshal([]byte(res), &resp); errUnmarshal != nil {
+		return zero, fmt.Errorf("failed to unmarshal %s response: %w. Raw response: %s", op, errUnmarshal, res)
+	}
+	if resp.Status >= 400 {
+		return zero, fmt.Errorf("%s returned status %d: %s", op, resp.Status, res)
+	}
+	return resp.Data, nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func bucketJSON(uuid string, name string, description string) map[string]any {
+	return map[string]any{"bucketUuid": uuid, "name": name, "description": description, "bucketType": 1}
+}
+
+func TestCreateBucket_EncodesJSON(t *testing.T) {
+	defer gock.Off()
+
+	name := `my "quoted" bucket`
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets").
+		MatchType("json").
+		JSON(map[string]string{"name": name}).
+		Reply(201).
+		JSON(map[string]any{"status": 201, "data": bucketJSON("new-bucket-uuid", name, "")})
+
+	bucket, err := CreateBucket(name, "")
+	if err != nil {
+		t.Fatalf("CreateBucket returned error: %v", err)
+	}
+	if bucket.BucketUUID != "new-bucket-uuid" || bucket.Name != name {
+		t.Errorf("unexpected bucket %+v", bucket)
+	}
+	if !gock.IsDone() {
+		t.Error("request body did not match")
+	}
+}
+
+func TestUpdateBucket(t *testing.T) {
+	defer gock.Off()
+
+	gock.New("https://api.apillon.io").
+		Patch("/storage/buckets/test-bucket-uuid").
+		MatchType("json").
+		JSON(map[string]string{"description": ""}).
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": bucketJSON("test-bucket-uuid", "assets", "")})
+
+	description := ""
+	bucket, err := UpdateBucket("test-bucket-uuid", BucketUpdate{Description: &description})
+	if err != nil {
+		t.Fatalf("UpdateBucket returned error: %v", err)
+	}
+	if bucket.Name != "assets" || !gock.IsDone() {
+		t.Errorf("unexpected bucket %+v", bucket)
+	}
+
+	if _, err := UpdateBucket("test-bucket-uuid", BucketUpdate{}); err == nil {
+		t.Error("expected an error for an empty update")
+	}
+}
+
+func TestGetAndDeleteBucket(t *testing.T) {
+	defer gock.Off()
+
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/test-bucket-uuid").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": bucketJSON("test-bucket-uuid", "assets", "static files")})
+	gock.New("https://api.apillon.io").
+		Delete("/storage/buckets/missing-bucket-uuid").
+		Reply(404).
+		JSON(map[string]any{"status": 404, "code": 40406001, "message": "BUCKET_NOT_FOUND"})
+
+	bucket, err := GetBucketByUUID("test-bucket-uuid")
+	if err != nil || bucket.Description != "static files" {
+		t.Errorf("GetBucketByUUID = %+v, %v", bucket, err)
+	}
+	if _, err := DeleteBucket("missing-bucket-uuid"); err == nil {
+		t.Error("expected an error for a missing bucket")
+	}
+}
+
+func TestIterateBuckets(t *testing.T) {
+	defer gock.Off()
+
+	for page, names := range [][]string{{"a", "b"}, {"c"}} {
+		items := make([]map[string]any, len(names))
+		for i, name := range names {
+			items[i] = bucketJSON("uuid-"+name, name, "")
+		}
+		gock.New("https://api.apillon.io").
+			Get("/storage/buckets").
+			MatchParam("page", "^"+strconv.Itoa(page+1)+"$").
+			MatchParam("limit", "^2$").
+			MatchParam("search", "^site$").
+			Reply(200).
+			JSON(map[string]any{"status": 200, "data": map[string]any{"total": 3, "items": items}})
+	}
+
+	var names []string
+	for bucket, err := range IterateBuckets(ListBucketsOptions{Search: "site", Limit: 2}) {
+		if err != nil {
+			t.Fatalf("IterateBuckets returned error: %v", err)
+		}
+		names = append(names, bucket.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("listed %v", names)
+	}
+}
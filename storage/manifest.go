@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+)
+
+// ManifestOptions configures the manifest written after an upload.
+type ManifestOptions struct {
+	JSONPath    string      // File the JSON manifest is written to; empty to skip
+	CSVPath     string      // File the CSV manifest is written to; empty to skip
+	WaitForCIDs bool        // Wait for the uploaded files to be pinned so the manifest includes their CID and link
+	Wait        WaitOptions // How long to wait when WaitForCIDs is set
+}
+
+// ManifestEntry describes one uploaded file. Size, SHA-256 and local CIDs are computed from the
+// content as stored, so they describe the compressed or encrypted bytes when those options are used.
+type ManifestEntry struct {
+	Path       string `json:"path"`           // Path of the file in the bucket, including its name
+	Size       int64  `json:"size"`           // Size of the stored content in bytes
+	SHA256     string `json:"sha256"`         // Hex-encoded SHA-256 of the stored content
+	LocalCID   string `json:"localCid"`       // CIDv0 computed locally
+	LocalCIDv1 string `json:"localCidV1"`     // Raw-leaf CIDv1 computed locally
+	FileUUID   string `json:"fileUuid"`       // Unique identifier for the file
+	CID        string `json:"cid,omitempty"`  // CID reported by Apillon, if known
+	Link       string `json:"link,omitempty"` // Link to the file reported by Apillon, if known
+}
+
+// Manifest lists the files of an upload for auditing and later verification.
+type Manifest struct {
+	BucketUUID string          `json:"bucketUuid"` // UUID of the bucket the files were uploaded to
+	CreatedAt  time.Time       `json:"createdAt"`  // When the manifest was created
+	Files      []ManifestEntry `json:"files"`      // Uploaded files
+}
+
+// manifestCSVHeader is the header row of CSV manifests.
+var manifestCSVHeader = []string{"bucketUuid", "path", "size", "sha256", "localCid", "localCidV1", "fileUuid", "cid", "link"}
+
+// WriteJSON writes the manifest as indented JSON.
+func (m Manifest) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// WriteCSV writes the manifest as CSV with a header row and one row per file.
+// The bucket UUID is repeated on every row; CreatedAt is not included.
+func (m Manifest) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(manifestCSVHeader); err != nil {
+		return err
+	}
+	for _, e := range m.Files {
+		row := []string{m.BucketUUID, e.Path, strconv.FormatInt(e.Size, 10), e.SHA256, e.LocalCID, e.LocalCIDv1, e.FileUUID, e.CID, e.Link}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadManifestJSON reads a manifest written by WriteJSON.
+func ReadManifestJSON(r io.Reader) (Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return Manifest{}, fmt.Errorf("failed to parse JSON manifest: %w", err)
+	}
+	return m, nil
+}
+
+// ReadManifestCSV reads a manifest written by WriteCSV.
+func ReadManifestCSV(r io.Reader) (Manifest, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to parse CSV manifest: %w", err)
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(manifestCSVHeader, ",") {
+		return Manifest{}, fmt.Errorf("CSV manifest has an unexpected header")
+	}
+
+	var m Manifest
+	for n, row := range rows[1:] {
+		size, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("invalid size on line %d of CSV manifest: %w", n+2, err)
+		}
+		m.BucketUUID = row[0]
+		m.Files = append(m.Files, ManifestEntry{
+			Path:       row[1],
+			Size:       size,
+			SHA256:     row[3],
+			LocalCID:   row[4],
+			LocalCIDv1: row[5],
+			FileUUID:   row[6],
+			CID:        row[7],
+			Link:       row[8],
+		})
+	}
+	return m, nil
+}
+
+// LoadManifest reads a manifest file, as CSV if its name ends in ".csv" and as JSON otherwise.
+func LoadManifest(path string) (Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ReadManifestCSV(f)
+	}
+	return ReadManifestJSON(f)
+}
+
+// ManifestMismatch describes a manifest entry that does not match the bucket contents.
+type ManifestMismatch struct {
+	Entry  ManifestEntry // Entry from the manifest
+	Remote *FileInfo     // File found in the bucket, nil if it is missing
+	Reason string        // What differs
+}
+
+// VerifyManifest compares every entry of a manifest with the files currently in its bucket.
+// Files are looked up by UUID, falling back to their path, and compared by size and CID. The remote
+// CID must equal the recorded CID, or reference the same DAG as the locally computed CIDs.
+// Returns the entries that do not match, or an error if the bucket cannot be listed.
+func VerifyManifest(m Manifest) ([]ManifestMismatch, error) {
+	if m.BucketUUID == "" {
+		return nil, fmt.Errorf("manifest has no bucket uuid")
+	}
+
+	remoteFiles, err := listBucketFiles(m.BucketUUID)
+	if err != nil {
+		return nil, err
+	}
+	byUUID := make(map[string]FileInfo, len(remoteFiles))
+	byPath := make(map[string]FileInfo, len(remoteFiles))
+	for _, info := range remoteFiles {
+		byUUID[info.FileUUID] = info
+		byPath[remoteFilePath(info)] = info
+	}
+
+	var mismatches []ManifestMismatch
+	for _, entry := range m.Files {
+		remote, ok := byUUID[entry.FileUUID]
+		if !ok {
+			remote, ok = byPath[entry.Path]
+		}
+		if !ok {
+			mismatches = append(mismatches, ManifestMismatch{Entry: entry, Reason: "missing from bucket"})
+			continue
+		}
+
+		if reason := manifestEntryDiff(entry, remote); reason != "" {
+			mismatches = append(mismatches, ManifestMismatch{Entry: entry, Remote: &remote, Reason: reason})
+		}
+	}
+
+	log.Printf("Verified %d manifest entries against bucket %s: %d mismatches", len(m.Files), m.BucketUUID, len(mismatches))
+	return mismatches, nil
+}
+
+// manifestEntryDiff returns why a remote file does not match its manifest entry, or "" if it does.
+func manifestEntryDiff(entry ManifestEntry, remote FileInfo) string {
+	if remote.Size != 0 && remote.Size != entry.Size {
+		return fmt.Sprintf("size is %d, manifest has %d", remote.Size, entry.Size)
+	}
+	if remote.CID == "" {
+		return "no CID yet"
+	}
+	if remote.CID == entry.CID {
+		return ""
+	}
+
+	remoteCID, err := cid.Parse(remote.CID)
+	if err != nil {
+		return fmt.Sprintf("invalid remote CID %s", remote.CID)
+	}
+	v0, errV0 := cid.Parse(entry.LocalCID)
+	v1, errV1 := cid.Parse(entry.LocalCIDv1)
+	if errV0 == nil && errV1 == nil && cidMatches(remoteCID, v0, v1) {
+		return ""
+	}
+	expected := entry.CID
+	if expected == "" {
+		expected = entry.LocalCID
+	}
+	return fmt.Sprintf("CID is %s, manifest has %s", remote.CID, expected)
+}
+
+// buildManifest describes the uploaded files, waiting for their CIDs if opts asks for it.
+// An error from waiting is returned together with the manifest of the files known so far.
+func buildManifest(bucketUuid string, files []WholeFile, result UploadResult, opts *ManifestOptions) (Manifest, error) {
+	m := Manifest{BucketUUID: bucketUuid, CreatedAt: time.Now().UTC(), Files: make([]ManifestEntry, 0, len(files))}
+	for i, file := range files {
+		content := []byte(file.Content)
+		sum := sha256.Sum256(content)
+		v0, err := cid.FromBytes(content, cid.V0())
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to compute CID for file %s: %w", file.Metadata.FileName, err)
+		}
+		v1, err := cid.FromBytes(content, cid.V1())
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to compute CID for file %s: %w", file.Metadata.FileName, err)
+		}
+
+		m.Files = append(m.Files, ManifestEntry{
+			Path:       localFilePath(file.Metadata),
+			Size:       int64(len(content)),
+			SHA256:     hex.EncodeToString(sum[:]),
+			LocalCID:   v0.String(),
+			LocalCIDv1: v1.String(),
+			FileUUID:   result.Files[i].FileUUID,
+		})
+	}
+
+	if !opts.WaitForCIDs {
+		return m, nil
+	}
+
+	fileUuids := make([]string, len(m.Files))
+	for i, e := range m.Files {
+		fileUuids[i] = e.FileUUID
+	}
+	infos, err := WaitForFiles(bucketUuid, "", fileUuids, opts.Wait)
+	byUUID := make(map[string]FileInfo, len(infos))
+	for _, info := range infos {
+		byUUID[info.FileUUID] = info
+	}
+	for i := range m.Files {
+		info := byUUID[m.Files[i].FileUUID]
+		m.Files[i].CID = info.CID
+		m.Files[i].Link = info.Link
+	}
+	return m, err
+}
+
+// writeManifest builds the manifest of an upload and writes it to the paths in opts.
+func writeManifest(bucketUuid string, files []WholeFile, result UploadResult, opts *ManifestOptions) error {
+	m, waitErr := buildManifest(bucketUuid, files, result, opts)
+	if m.BucketUUID == "" {
+		return waitErr
+	}
+
+	var errs []error
+	if waitErr != nil {
+		log.Printf("Writing manifest for bucket %s without some CIDs: %v", bucketUuid, waitErr)
+		errs = append(errs, waitErr)
+	}
+	if opts.JSONPath != "" {
+		errs = append(errs, writeManifestFile(opts.JSONPath, m.WriteJSON))
+	}
+	if opts.CSVPath != "" {
+		errs = append(errs, writeManifestFile(opts.CSVPath, m.WriteCSV))
+	}
+	return errors.Join(errs...)
+}
+
+// writeManifestFile writes a manifest to path, replacing it atomically.
+func writeManifestFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write manifest %s: %w", path, err)
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write manifest %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write manifest %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write manifest %s: %w", path, err)
+	}
+	log.Printf("Manifest written to %s", path)
+	return nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestUploadFileProcessWithOptions_WritesManifest(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	files := []WholeFile{{Metadata: FileMetadata{FileName: "a.txt", Path: "docs"}, Content: "hello"}}
+	localCID, err := cid.FromBytes([]byte("hello"), cid.V0())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gock.New("https://api.apillon.io").
+		Post("/storage/buckets/" + bucketUUID + "/upload$").
+		Reply(200).
+		JSON(map[string]any{"data": map[string]any{
+			"sessionUuid": "session-1",
+			"files":       []map[string]any{{"fileName": "a.txt", "path": "docs", "url": "https://s3.example.com/a", "fileUuid": "file-a"}},
+		}})
+	gock.New("https://s3.example.com").Put("/a").Reply(200)
+	gock.New("https://api.apillon.io").Post("/upload/session-1/end").Reply(200).JSON(map[string]any{"data": true})
+	gock.New("https://api.apillon.io").Get("/storage/buckets/" + bucketUUID + "/files/file-a").Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{
+			"fileUuid": "file-a", "fileStatus": 4, "CID": localCID.String(), "link": "https://ipfs.example.com/a",
+		}})
+
+	dir := t.TempDir()
+	opts := UploadOptions{Manifest: &ManifestOptions{
+		JSONPath:    filepath.Join(dir, "manifest.json"),
+		CSVPath:     filepath.Join(dir, "manifest.csv"),
+		WaitForCIDs: true,
+		Wait:        fastWait,
+	}}
+	if _, err := UploadFileProcessWithOptions(bucketUUID, files, opts); err != nil {
+		t.Fatalf("UploadFileProcessWithOptions returned error: %v", err)
+	}
+
+	fromJSON, err := LoadManifest(opts.Manifest.JSONPath)
+	if err != nil {
+		t.Fatalf("LoadManifest(json) returned error: %v", err)
+	}
+	fromCSV, err := LoadManifest(opts.Manifest.CSVPath)
+	if err != nil {
+		t.Fatalf("LoadManifest(csv) returned error: %v", err)
+	}
+
+	want := ManifestEntry{
+		Path:     "docs/a.txt",
+		Size:     5,
+		SHA256:   "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		LocalCID: localCID.String(),
+		FileUUID: "file-a",
+		CID:      localCID.String(),
+		Link:     "https://ipfs.example.com/a",
+	}
+	for name, m := range map[string]Manifest{"json": fromJSON, "csv": fromCSV} {
+		if m.BucketUUID != bucketUUID || len(m.Files) != 1 {
+			t.Fatalf("%s manifest = %+v", name, m)
+		}
+		got := m.Files[0]
+		got.LocalCIDv1 = ""
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s manifest entry = %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	defer gock.Off()
+
+	v0, _ := cid.FromBytes([]byte("hello"), cid.V0())
+	v1, _ := cid.FromBytes([]byte("hello"), cid.V1())
+	m := Manifest{BucketUUID: "test-bucket-uuid", Files: []ManifestEntry{
+		{Path: "a.txt", Size: 5, LocalCID: v0.String(), LocalCIDv1: v1.String(), FileUUID: "file-a"},
+		{Path: "b.txt", Size: 5, LocalCID: v0.String(), LocalCIDv1: v1.String(), FileUUID: "file-b"},
+		{Path: "c.txt", Size: 5, LocalCID: v0.String(), LocalCIDv1: v1.String(), FileUUID: "file-c"},
+		{Path: "d.txt", Size: 5, LocalCID: v0.String(), LocalCIDv1: v1.String(), FileUUID: "file-d"},
+	}}
+
+	mockBucketFiles(m.BucketUUID, []map[string]any{
+		{"fileUuid": "file-a", "name": "a.txt", "size": 5, "CID": v1.String()},
+		{"fileUuid": "file-b", "name": "b.txt", "size": 6, "CID": v0.String()},
+		{"fileUuid": "other", "name": "c.txt", "size": 5, "CID": "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"},
+	})
+
+	mismatches, err := VerifyManifest(m)
+	if err != nil {
+		t.Fatalf("VerifyManifest returned error: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, mm := range mismatches {
+		got[mm.Entry.Path] = true
+	}
+	if want := map[string]bool{"b.txt": true, "c.txt": true, "d.txt": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mismatched entries = %v, want %v (%+v)", got, want, mismatches)
+	}
+}
@@ -0,0 +1,70 @@
+package storage
+
+import "strconv"
+
+// FileStatus is the processing state of a file, as reported by Apillon in FileInfo.FileStatus.
+type FileStatus int
+
+// File status codes reported by Apillon.
+const (
+	FileStatusUploadRequested FileStatus = 1 // Signed URL for upload generated
+	FileStatusUploadedToS3    FileStatus = 2 // File uploaded to the staging storage
+	FileStatusUploadedToIPFS  FileStatus = 3 // File added to IPFS and has a CID
+	FileStatusPinned          FileStatus = 4 // File pinned and replicated
+)
+
+// String returns a readable name for the status, e.g. "pinned".
+func (s FileStatus) String() string {
+	switch s {
+	case FileStatusUploadRequested:
+		return "upload requested"
+	case FileStatusUploadedToS3:
+		return "uploaded to S3"
+	case FileStatusUploadedToIPFS:
+		return "uploaded to IPFS"
+	case FileStatusPinned:
+		return "pinned"
+	default:
+		return "unknown(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// IsPinned reports whether the file is pinned and replicated.
+func (s FileStatus) IsPinned() bool {
+	return s == FileStatusPinned
+}
+
+// IsOnIPFS reports whether the file has been added to IPFS, so its CID is known.
+func (s FileStatus) IsOnIPFS() bool {
+	return s == FileStatusUploadedToIPFS || s == FileStatusPinned
+}
+
+// IsTerminal reports whether Apillon has finished processing the file. A pinned file
+// does not change status again; every other status is still in progress.
+func (s FileStatus) IsTerminal() bool {
+	return s == FileStatusPinned
+}
+
+// BucketType is the kind of a bucket, as reported by Apillon in BucketItem.BucketType.
+type BucketType int
+
+// Bucket types reported by Apillon.
+const (
+	BucketTypeStorage     BucketType = 1 // Bucket created through the storage API
+	BucketTypeHosting     BucketType = 2 // Bucket backing a hosted website
+	BucketTypeNFTMetadata BucketType = 3 // Bucket holding NFT metadata
+)
+
+// String returns a readable name for the bucket type, e.g. "storage".
+func (t BucketType) String() string {
+	switch t {
+	case BucketTypeStorage:
+		return "storage"
+	case BucketTypeHosting:
+		return "hosting"
+	case BucketTypeNFTMetadata:
+		return "nft metadata"
+	default:
+		return "unknown(" + strconv.Itoa(int(t)) + ")"
+	}
+}
@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SyncDirection selects which side of a sync is the source of truth.
+type SyncDirection int
+
+const (
+	// SyncPush makes the bucket match the local directory.
+	SyncPush SyncDirection = iota
+	// SyncPull makes the local directory match the bucket.
+	SyncPull
+)
+
+func (d SyncDirection) String() string {
+	if d == SyncPull {
+		return "pull"
+	}
+	return "push"
+}
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	Direction  SyncDirection // Which side is copied to the other; defaults to SyncPush
+	RemotePath string        // Directory in the bucket mirrored by the local directory; defaults to the bucket root
+	Delete     bool          // Delete files on the destination that are missing on the source
+	DryRun     bool          // Only compute and print the plan
+	Output     io.Writer     // Where the plan is printed; defaults to os.Stdout
+	Ignore     IgnoreOptions // Local files to leave out; matching remote paths are left alone too
+	Upload     UploadOptions // Options for uploading new and changed files when pushing
+}
+
+// SyncPlan lists the differences found by Sync. Paths are relative to the synced directory
+// and use forward slashes.
+type SyncPlan struct {
+	Direction   SyncDirection
+	New         []string // Files missing on the destination
+	Changed     []string // Files that differ between source and destination
+	Deleted     []string // Files on the destination missing on the source, only with Delete
+	Directories []string // Remote directories deleted as a whole when pushing with Delete
+}
+
+// Empty reports whether the plan has nothing to apply.
+func (p SyncPlan) Empty() bool {
+	return len(p.New) == 0 && len(p.Changed) == 0 && len(p.Deleted) == 0
+}
+
+// Print writes a human-readable description of the plan to w.
+func (p SyncPlan) Print(w io.Writer, localDir string, bucketUuid string) {
+	fmt.Fprintf(w, "Sync plan (%s) between %s and bucket %s: %d new, %d changed, %d deleted\n",
+		p.Direction, localDir, bucketUuid, len(p.New), len(p.Changed), len(p.Deleted))
+	for _, f := range p.New {
+		fmt.Fprintf(w, "  + %s\n", f)
+	}
+	for _, f := range p.Changed {
+		fmt.Fprintf(w, "  ~ %s\n", f)
+	}
+	for _, f := range p.Deleted {
+		fmt.Fprintf(w, "  - %s\n", f)
+	}
+	for _, d := range p.Directories {
+		fmt.Fprintf(w, "  - %s/\n", d)
+	}
+}
+
+// Sync compares a local directory with the files in a bucket and copies new and changed files
+// from the source side to the destination, like rsync. Files are compared by path and size, and
+// by CID when the remote file has one. With opts.Delete, files missing on the source are deleted
+// from the destination; when pushing, remote directories missing locally are removed with
+// DeleteDirectory unless they hold ignored remote files. Paths ignored by opts.Ignore (including
+// the .apillonignore file of localDir) are left untouched on both sides. The plan is printed to opts.Output before it is applied, and opts.DryRun stops there.
+// Returns the plan and any errors encountered while applying it.
+func Sync(localDir string, bucketUuid string, opts SyncOptions) (SyncPlan, error) {
+	if localDir == "" {
+		return SyncPlan{}, fmt.Errorf("local directory is required")
+	}
+	if bucketUuid == "" {
+		return SyncPlan{}, fmt.Errorf("bucket uuid is required")
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+
+	prefix := strings.Trim(opts.RemotePath, "/")
+
+	filter, err := newLocalFilter(localDir, opts.Ignore)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+
+	localFiles, err := readLocalDirectory(localDir, prefix, filter)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	// When pushing, local files are compared in the form they are stored in, so compressed files
+	// match their remote counterparts; uploads still start from the original files
+	stored := localFiles
+	if opts.Direction == SyncPush {
+		stored, err = storedFiles(localFiles, opts.Upload)
+		if err != nil {
+			return SyncPlan{}, err
+		}
+	}
+	local := make(map[string]WholeFile, len(localFiles))
+	originals := make(map[string]WholeFile, len(localFiles))
+	for i, file := range stored {
+		rel := relativePath(prefix, localFilePath(file.Metadata))
+		local[rel] = file
+		originals[rel] = localFiles[i]
+	}
+
+	remoteFiles, err := listBucketFiles(bucketUuid)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	remote := make(map[string]FileInfo)
+	var ignored []string // Remote files left alone because Ignore excludes them
+	for _, info := range remoteFiles {
+		rel, ok := underPrefix(prefix, remoteFilePath(info))
+		if !ok {
+			continue
+		}
+		if filter.skipPath(rel) {
+			ignored = append(ignored, rel)
+			continue
+		}
+		remote[rel] = info
+	}
+
+	inLocal := func(rel string) bool { _, ok := local[rel]; return ok }
+	inRemote := func(rel string) bool { _, ok := remote[rel]; return ok }
+
+	plan := SyncPlan{Direction: opts.Direction}
+	source, inDestination := keys(local), inRemote
+	destination, inSource := keys(remote), inLocal
+	if opts.Direction == SyncPull {
+		source, inDestination = keys(remote), inLocal
+		destination, inSource = keys(local), inRemote
+	}
+	// Encrypted uploads differ on every push, so existing files cannot be compared and are always sent
+	encrypted := opts.Direction == SyncPush && opts.Upload.Encryption != nil
+	for _, rel := range source {
+		if !inDestination(rel) {
+			plan.New = append(plan.New, rel)
+		} else if encrypted || !sameContent(local[rel], remote[rel]) {
+			plan.Changed = append(plan.Changed, rel)
+		}
+	}
+	if opts.Delete {
+		for _, rel := range destination {
+			if !inSource(rel) {
+				plan.Deleted = append(plan.Deleted, rel)
+			}
+		}
+	}
+	if opts.Direction == SyncPush && opts.Delete {
+		plan.Directories = missingDirectories(localDir, plan.Deleted, ignored)
+	}
+
+	plan.Print(opts.Output, localDir, bucketUuid)
+	if opts.DryRun || plan.Empty() {
+		return plan, nil
+	}
+
+	if opts.Direction == SyncPull {
+		return plan, applyPull(localDir, plan, remote)
+	}
+	return plan, applyPush(bucketUuid, prefix, plan, originals, remote, opts.Upload)
+}
+
+// applyPush uploads new and changed files and deletes remote files missing locally. Directories
+// are looked up below prefix, the remote directory mirrored by the local directory.
+func applyPush(bucketUuid string, prefix string, plan SyncPlan, local map[string]WholeFile, remote map[string]FileInfo, opts UploadOptions) error {
+	var errs []error
+
+	var pending []WholeFile
+	for _, rel := range append(append([]string{}, plan.New...), plan.Changed...) {
+		pending = append(pending, local[rel])
+	}
+	if len(pending) > 0 {
+		if _, err := UploadFileProcessWithOptions(bucketUuid, pending, opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	deletedDirs := make(map[string]bool)
+	for _, dir := range plan.Directories {
+		uuid, err := ResolveDirectoryPath(bucketUuid, path.Join(prefix, dir))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to look up directory %s: %w", dir, err))
+			continue
+		}
+		if _, err := DeleteDirectory(bucketUuid, uuid); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete directory %s: %w", dir, err))
+			continue
+		}
+		deletedDirs[dir] = true
+	}
+
+	for _, rel := range plan.Deleted {
+		if insideAny(rel, deletedDirs) {
+			continue
+		}
+		if _, err := DeleteFile(bucketUuid, remote[rel].FileUUID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete file %s: %w", rel, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyPull downloads new and changed remote files and deletes local files missing remotely.
+// Remote paths that would be written outside localDir are reported as errors.
+func applyPull(localDir string, plan SyncPlan, remote map[string]FileInfo) error {
+	var errs []error
+
+	for _, rel := range append(append([]string{}, plan.New...), plan.Changed...) {
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			errs = append(errs, fmt.Errorf("refusing to download %s: path leaves %s", rel, localDir))
+			continue
+		}
+		link, err := fileLink(remote[rel])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to resolve link for %s: %w", rel, err))
+			continue
+		}
+		if err := downloadToPath(link, filepath.Join(localDir, filepath.FromSlash(rel))); err != nil {
+			errs = append(errs, fmt.Errorf("failed to download %s: %w", rel, err))
+		}
+	}
+
+	for _, rel := range plan.Deleted {
+		if err := os.Remove(filepath.Join(localDir, filepath.FromSlash(rel))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %w", rel, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// readLocalDirectory reads every regular file below localDir that is not skipped by filter.
+// Each file's Path is its directory relative to localDir, placed under prefix.
+func readLocalDirectory(localDir string, prefix string, filter *localFilter) ([]WholeFile, error) {
+	var files []WholeFile
+	err := filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel != "." && filter.skipDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || filter.skipFile(rel) {
+			return nil
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		dir := path.Dir(rel)
+		if dir == "." {
+			dir = ""
+		}
+		files = append(files, WholeFile{
+			Content: string(content),
+			Metadata: FileMetadata{
+				FileName: d.Name(),
+				Path:     strings.Trim(path.Join(prefix, dir), "/"),
+			},
+		})
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to read local directory %s: %v", localDir, err)
+		return nil, err
+	}
+	return files, nil
+}
+
+// missingDirectories returns the topmost ancestor directories of deleted files that no longer
+// exist in localDir. Directories holding any of the ignored remote files are left out so that
+// deleting them as a whole cannot remove those files; their deleted files are removed one by one.
+func missingDirectories(localDir string, deleted []string, ignored []string) []string {
+	candidates := make(map[string]bool)
+	for _, rel := range deleted {
+		for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if _, err := os.Stat(filepath.Join(localDir, filepath.FromSlash(dir))); errors.Is(err, fs.ErrNotExist) {
+				candidates[dir] = true
+			}
+		}
+	}
+	for _, rel := range ignored {
+		for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			delete(candidates, dir)
+		}
+	}
+
+	dirs := keys(candidates)
+	var topmost []string
+	selected := make(map[string]bool)
+	for _, dir := range dirs {
+		if insideAny(dir, selected) {
+			continue
+		}
+		selected[dir] = true
+		topmost = append(topmost, dir)
+	}
+	return topmost
+}
+
+// insideAny reports whether p is inside one of dirs.
+func insideAny(p string, dirs map[string]bool) bool {
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if dirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// underPrefix returns p relative to prefix, and whether p lies below prefix.
+func underPrefix(prefix string, p string) (string, bool) {
+	if prefix == "" {
+		return p, true
+	}
+	if strings.HasPrefix(p, prefix+"/") {
+		return strings.TrimPrefix(p, prefix+"/"), true
+	}
+	return "", false
+}
+
+// relativePath strips prefix from a bucket path.
+func relativePath(prefix string, p string) string {
+	rel, _ := underPrefix(prefix, p)
+	return rel
+}
+
+// keys returns the sorted keys of m.
+func keys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
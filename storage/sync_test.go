@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func mockBucketFiles(bucketUUID string, items []map[string]any) {
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/" + bucketUUID + "/files").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"total": len(items), "items": items}})
+}
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSync_PushPlan(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"index.html":    "<html></html>",
+		"css/site.css":  "body{}",
+		"img/new.png":   "png",
+		"unchanged.txt": "same",
+	})
+
+	oldDir := "old-dir-uuid"
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "1", "name": "index.html", "path": "site/", "size": 3},
+		{"fileUuid": "2", "name": "site.css", "path": "site/css/", "size": 6},
+		{"fileUuid": "3", "name": "unchanged.txt", "path": "site/", "size": 4},
+		{"fileUuid": "4", "name": "stale.txt", "path": "site/", "size": 1},
+		{"fileUuid": "5", "name": "a.js", "path": "site/old/", "size": 1, "directoryUuid": oldDir},
+		{"fileUuid": "6", "name": "outside.txt", "path": "other/", "size": 1},
+	})
+
+	var out bytes.Buffer
+	plan, err := Sync(dir, bucketUUID, SyncOptions{RemotePath: "/site/", Delete: true, DryRun: true, Output: &out})
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+
+	if want := []string{"img/new.png"}; !reflect.DeepEqual(plan.New, want) {
+		t.Errorf("New = %v, want %v", plan.New, want)
+	}
+	if want := []string{"index.html"}; !reflect.DeepEqual(plan.Changed, want) {
+		t.Errorf("Changed = %v, want %v", plan.Changed, want)
+	}
+	if want := []string{"old/a.js", "stale.txt"}; !reflect.DeepEqual(plan.Deleted, want) {
+		t.Errorf("Deleted = %v, want %v", plan.Deleted, want)
+	}
+	if want := []string{"old"}; !reflect.DeepEqual(plan.Directories, want) {
+		t.Errorf("Directories = %v, want %v", plan.Directories, want)
+	}
+	if out.Len() == 0 {
+		t.Error("expected the plan to be printed")
+	}
+}
+
+func TestSync_Pull(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"local-only.txt": "x"})
+
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "1", "name": "remote.txt", "path": "docs/", "size": 6, "link": "https://gateway.example.com/remote"},
+	})
+	gock.New("https://gateway.example.com").Get("/remote").Reply(200).BodyString("remote")
+
+	_, err := Sync(dir, bucketUUID, SyncOptions{Direction: SyncPull, Delete: true, Output: &bytes.Buffer{}})
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "docs", "remote.txt"))
+	if err != nil || string(content) != "remote" {
+		t.Errorf("remote file was not downloaded: %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "local-only.txt")); !os.IsNotExist(err) {
+		t.Errorf("local-only file should be deleted, stat error: %v", err)
+	}
+}
+
+func TestSync_PullRejectsTraversal(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b")
+	writeTestFiles(t, dir, map[string]string{"keep.txt": "x"})
+
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "1", "name": ".bashrc", "path": "../../", "size": 4, "link": "https://gateway.example.com/evil"},
+		{"fileUuid": "2", "name": "keep.txt", "path": "", "size": 1, "link": "https://gateway.example.com/keep"},
+	})
+	gock.New("https://gateway.example.com").Get("/evil").Persist().Reply(200).BodyString("evil")
+
+	_, err := Sync(dir, bucketUUID, SyncOptions{Direction: SyncPull, Output: &bytes.Buffer{}})
+	if err == nil || !strings.Contains(err.Error(), "../../.bashrc") {
+		t.Errorf("expected the traversal to be reported, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".bashrc")); !os.IsNotExist(err) {
+		t.Errorf("file was written outside the local directory, stat error: %v", err)
+	}
+}
+
+func TestSync_PushKeepsIgnoredFilesInDeletedDirectory(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"keep.txt": "keep"})
+
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "1", "name": "keep.txt", "path": "", "size": 4},
+		{"fileUuid": "2", "name": "a.js", "path": "old/", "size": 1, "directoryUuid": "old-dir-uuid"},
+		{"fileUuid": "3", "name": "debug.log", "path": "old/", "size": 1, "directoryUuid": "old-dir-uuid"},
+	})
+	// Only the synced file is deleted; deleting the directory would also remove debug.log
+	gock.New("https://api.apillon.io").
+		Delete("/storage/buckets/" + bucketUUID + "/files/2").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+
+	plan, err := Sync(dir, bucketUUID, SyncOptions{Delete: true, Ignore: IgnoreOptions{Exclude: []string{"*.log"}}, Output: &bytes.Buffer{}})
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if len(plan.Directories) != 0 || !reflect.DeepEqual(plan.Deleted, []string{"old/a.js"}) {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+	if !gock.IsDone() {
+		t.Error("expected the file to be deleted on its own")
+	}
+}
+
+func TestSync_PushMatchesCompressedFiles(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	dir := t.TempDir()
+	data := strings.Repeat(`{"key":"value"},`, 200)
+	writeTestFiles(t, dir, map[string]string{"data.json": data})
+
+	compression := &CompressionOptions{}
+	stored, err := compressFiles([]WholeFile{{Metadata: FileMetadata{FileName: "data.json", ContentType: "application/json"}, Content: data}}, compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "1", "name": "data.json.apillon.gz", "path": "", "size": len(stored[0].Content)},
+	})
+
+	plan, err := Sync(dir, bucketUUID, SyncOptions{Delete: true, DryRun: true, Upload: UploadOptions{Compression: compression}, Output: &bytes.Buffer{}})
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if !plan.Empty() {
+		t.Errorf("compressed file should match its local original, got %+v", plan)
+	}
+}
+
+func TestSync_PushDeletesDirectoryHoldingOnlySubdirectories(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"keep.txt": "keep"})
+
+	// The local a/ is gone and the remote a/ holds nothing but the subdirectory b/
+	mockBucketFiles(bucketUUID, []map[string]any{
+		{"fileUuid": "1", "name": "keep.txt", "path": "site/", "size": 4},
+		{"fileUuid": "2", "name": "c.txt", "path": "site/a/b/", "size": 1, "directoryUuid": "dir-b"},
+	})
+	mockContent(bucketUUID, "dir-site", []map[string]any{{"type": 1, "uuid": "dir-a", "name": "a"}})
+	mockContent(bucketUUID, "", []map[string]any{{"type": 1, "uuid": "dir-site", "name": "site"}})
+	gock.New("https://api.apillon.io").
+		Delete("/storage/buckets/" + bucketUUID + "/directories/dir-a").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": true})
+
+	plan, err := Sync(dir, bucketUUID, SyncOptions{RemotePath: "site", Delete: true, Output: &bytes.Buffer{}})
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(plan.Directories, want) {
+		t.Errorf("Directories = %v, want %v", plan.Directories, want)
+	}
+	if !gock.IsDone() {
+		t.Error("expected the whole remote directory to be deleted")
+	}
+}
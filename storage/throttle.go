@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunkSize caps how many bytes one throttled Read transfers, so concurrent transfers
+// share the limit fairly and a changed limit takes effect quickly.
+const throttleChunkSize = 32 * 1024
+
+// bandwidth is the limiter shared by every upload to a signed URL and every download.
+var bandwidth = &bandwidthLimiter{}
+
+// SetBandwidthLimit caps the combined transfer rate of all uploads to signed URLs and all downloads
+// at bytesPerSecond. Zero or a negative value removes the limit. It is safe to call at any time,
+// including while transfers are running; they continue at the new rate.
+func SetBandwidthLimit(bytesPerSecond int64) {
+	bandwidth.setRate(bytesPerSecond)
+}
+
+// BandwidthLimit returns the current transfer limit in bytes per second, or zero if unlimited.
+func BandwidthLimit() int64 {
+	bandwidth.mu.Lock()
+	defer bandwidth.mu.Unlock()
+	return bandwidth.rate
+}
+
+// bandwidthLimiter is a token bucket holding at most one second worth of bytes. Transfers take
+// tokens after reading and sleep off any debt, so readers sharing it never exceed the rate on average.
+type bandwidthLimiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func (l *bandwidthLimiter) setRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	l.rate = bytesPerSecond
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// chunk returns how many bytes the next read may transfer, or zero when there is no limit.
+func (l *bandwidthLimiter) chunk() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	// Keep single reads to roughly a tenth of a second of transfer
+	return int(min(max(l.rate/10, 1), throttleChunkSize))
+}
+
+// take accounts for n transferred bytes and blocks until the limit allows them.
+func (l *bandwidthLimiter) take(n int) {
+	l.mu.Lock()
+	if l.rate <= 0 || n <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	rate := float64(l.rate)
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*rate, rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// throttledReader limits reads from r with the shared bandwidth limiter.
+type throttledReader struct {
+	r io.Reader
+}
+
+// throttle wraps r so reading from it counts towards the bandwidth limit.
+func throttle(r io.Reader) io.Reader {
+	return &throttledReader{r: r}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if chunk := bandwidth.chunk(); chunk > 0 && len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	bandwidth.take(n)
+	return n, err
+}
+
+// throttledReadCloser is a throttledReader that closes the underlying body.
+type throttledReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// throttleBody wraps a response body so reading from it counts towards the bandwidth limit.
+func throttleBody(body io.ReadCloser) io.ReadCloser {
+	return throttledReadCloser{Reader: throttle(body), Closer: body}
+}
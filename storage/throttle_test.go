@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestThrottle_LimitsRate(t *testing.T) {
+	SetBandwidthLimit(100_000)
+	defer SetBandwidthLimit(0)
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, throttle(bytes.NewReader(make([]byte, 50_000))))
+	if err != nil || n != 50_000 {
+		t.Fatalf("copy returned %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("50kB at 100kB/s took %v, want about 500ms", elapsed)
+	}
+
+	SetBandwidthLimit(0)
+	start = time.Now()
+	io.Copy(io.Discard, throttle(bytes.NewReader(make([]byte, 1<<20))))
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("unlimited copy took %v", elapsed)
+	}
+	if BandwidthLimit() != 0 {
+		t.Errorf("BandwidthLimit() = %d, want 0", BandwidthLimit())
+	}
+}
+
+func TestUploadFiles_Throttled(t *testing.T) {
+	defer gock.Off()
+	SetBandwidthLimit(1 << 20)
+	defer SetBandwidthLimit(0)
+
+	content := strings.Repeat("x", 100_000)
+	gock.New("https://s3.example.com").Put("/upload").BodyString(content).Reply(200)
+
+	if _, err := UploadFiles("https://s3.example.com/upload", content); err != nil {
+		t.Fatalf("UploadFiles returned error: %v", err)
+	}
+	if !gock.IsDone() {
+		t.Error("upload did not reach the signed URL with its content")
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// timeLayouts are the timestamp formats accepted when decoding a Time, tried in order.
+// Timestamps without a zone are taken as UTC.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// Time is a timestamp reported by Apillon. It decodes from ISO 8601 strings with or without
+// fractional seconds and zone, Unix milliseconds, empty strings and null; the last two give
+// the zero time. It encodes as RFC 3339, or null when zero.
+type Time struct {
+	time.Time
+}
+
+// ParseTime parses a timestamp in any of the formats Apillon returns.
+func ParseTime(s string) (Time, error) {
+	if s == "" {
+		return Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return Time{t}, nil
+		}
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return Time{time.UnixMilli(ms).UTC()}, nil
+	}
+	return Time{}, fmt.Errorf("unrecognised timestamp %q", s)
+}
+
+// MarshalJSON encodes the time as an RFC 3339 string, or null when zero.
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time.Format(time.RFC3339Nano))
+}
+
+// UnmarshalJSON decodes a timestamp string, a number of Unix milliseconds, or null.
+func (t *Time) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*t = Time{}
+		return nil
+	}
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	} else {
+		s = string(data)
+	}
+	parsed, err := ParseTime(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// String returns the time in RFC 3339 format, or an empty string when zero.
+func (t Time) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Time.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTime_UnmarshalFormats(t *testing.T) {
+	want := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, input := range []string{
+		`"2025-01-02T03:04:05Z"`,
+		`"2025-01-02T03:04:05.000Z"`,
+		`"2025-01-02T04:04:05+01:00"`,
+		`"2025-01-02T03:04:05"`,
+		`"2025-01-02 03:04:05"`,
+		`1735787045000`,
+	} {
+		var got Time
+		if err := json.Unmarshal([]byte(input), &got); err != nil {
+			t.Errorf("Unmarshal(%s) returned error: %v", input, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", input, got, want)
+		}
+	}
+
+	for _, input := range []string{`null`, `""`} {
+		var got Time
+		if err := json.Unmarshal([]byte(input), &got); err != nil || !got.IsZero() {
+			t.Errorf("Unmarshal(%s) = %v, %v, want the zero time", input, got, err)
+		}
+	}
+
+	var got Time
+	if err := json.Unmarshal([]byte(`"yesterday"`), &got); err == nil {
+		t.Error("expected an error for an unrecognised timestamp")
+	}
+}
+
+func TestFileInfo_TypedFields(t *testing.T) {
+	data := `{"fileUuid":"file-1","fileStatus":3,"createTime":"2025-01-02T03:04:05.000Z","updateTime":null}`
+
+	var info FileInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.FileStatus != FileStatusUploadedToIPFS || !info.FileStatus.IsOnIPFS() || info.FileStatus.IsTerminal() {
+		t.Errorf("unexpected status %v", info.FileStatus)
+	}
+	if info.CreateTime.Year() != 2025 || !info.UpdateTime.IsZero() {
+		t.Errorf("unexpected timestamps %+v", info.Timestamps)
+	}
+
+	out, err := json.Marshal(info.Timestamps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"createTime":"2025-01-02T03:04:05Z","updateTime":null}` {
+		t.Errorf("Marshal = %s", out)
+	}
+	if FileStatus(9).String() != "unknown(9)" || BucketTypeHosting.String() != "hosting" {
+		t.Error("unexpected String output")
+	}
+}
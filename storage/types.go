@@ -1,9 +1,12 @@
 package storage
 
-// FileMetadata represents metadata for a file, including its name and content type.
+import "time"
+
+// FileMetadata represents metadata for a file, including its name, content type and optional directory path.
 type FileMetadata struct {
 	FileName    string `json:"fileName" validate:"required"` // Name of the file
 	ContentType string `json:"contentType"`                  // MIME type of the file
+	Path        string `json:"path,omitempty"`               // Virtual directory of the file in the bucket (optional)
 }
 
 // WholeFile represents a file's content and its associated metadata.
@@ -27,6 +30,43 @@ type ProcessData struct {
 	Files       []FileItem `json:"files"`       // List of files processed in the session
 }
 
+// Session is an upload session started with StartUploadFilesToBucket.
+type Session struct {
+	BucketUUID  string     // UUID of the bucket the files are uploaded to
+	SessionUUID string     // Unique identifier for the session
+	Files       []FileItem // Signed URL and file UUID of each file, identified by FileName and Path
+}
+
+// FileResult describes the upload of a single file.
+type FileResult struct {
+	FileName    string        // Name the file is stored under
+	Path        string        // Directory of the file in the bucket
+	FileUUID    string        // Unique identifier for the file
+	SessionUUID string        // Upload session the file was sent in
+	Size        int64         // Number of bytes uploaded
+	Duration    time.Duration // Time spent uploading the file; zero if it was uploaded by an earlier run
+	Err         error         // Why the file was not uploaded, nil on success
+}
+
+// UploadResult describes the outcome of an upload process.
+type UploadResult struct {
+	BucketUUID string         // UUID of the bucket the files were uploaded to
+	Files      []FileResult   // One entry per uploaded file, in the order the files were given
+	Skipped    []FileMetadata // Files left out by a PreUploadHook
+	Duration   time.Duration  // Total time of the upload process
+}
+
+// Failed returns the files that were not uploaded.
+func (r UploadResult) Failed() []FileResult {
+	var failed []FileResult
+	for _, f := range r.Files {
+		if f.Err != nil {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
 // APIResponse is a generic API response wrapper for all endpoints.
 // T is the type of the Data field.
 type APIResponse[T any] struct {
@@ -38,12 +78,18 @@ type APIResponse[T any] struct {
 // ListBucketsResponse represents a response containing a list of buckets.
 type ListBucketsResponse = APIResponse[BucketListData]
 
+// BucketResponse represents a response containing a single bucket.
+type BucketResponse = APIResponse[BucketItem]
+
 // ListFilesResponse represents a response containing a list of files.
 type ListFilesResponse = APIResponse[FileListData]
 
 // ProcessAPIResponse represents a response for file processing operations.
 type ProcessAPIResponse = APIResponse[ProcessData]
 
+// EndSessionResponse represents a response for ending an upload session.
+type EndSessionResponse = APIResponse[bool]
+
 // FileDetails represents a response containing details about a specific file.
 type FileDetails = APIResponse[FileInfo]
 
@@ -81,32 +127,67 @@ type FileListData = ListData[FileInfo]
 
 // Timestamps contains common timestamp fields for created and updated times.
 type Timestamps struct {
-	CreateTime string `json:"createTime"` // Creation timestamp (ISO8601 format)
-	UpdateTime string `json:"updateTime"` // Last update timestamp (ISO8601 format)
+	CreateTime Time `json:"createTime"` // Creation timestamp; zero if not reported
+	UpdateTime Time `json:"updateTime"` // Last update timestamp; zero if not reported
 }
 
 // FileInfo contains detailed information about a file.
 type FileInfo struct {
 	Timestamps
-	FileUUID      string  `json:"fileUuid"`                // Unique identifier for the file
-	CID           string  `json:"CID"`                     // Content Identifier (CID) for IPFS
-	Name          string  `json:"name"`                    // Name of the file
-	ContentType   string  `json:"contentType"`             // MIME type of the file
-	Path          *string `json:"path"`                    // Path to the file (nullable)
-	Size          int64   `json:"size"`                    // Size of the file in bytes
-	FileStatus    int     `json:"fileStatus"`              // Status code of the file
-	Link          string  `json:"link"`                    // URL or IPFS link to the file
-	DirectoryUUID *string `json:"directoryUuid,omitempty"` // UUID of the parent directory (nullable)
+	FileUUID      string     `json:"fileUuid"`                // Unique identifier for the file
+	CID           string     `json:"CID"`                     // Content Identifier (CID) for IPFS
+	Name          string     `json:"name"`                    // Name of the file
+	ContentType   string     `json:"contentType"`             // MIME type of the file
+	Path          *string    `json:"path"`                    // Path to the file (nullable)
+	Size          int64      `json:"size"`                    // Size of the file in bytes
+	FileStatus    FileStatus `json:"fileStatus"`              // Processing status of the file
+	Link          string     `json:"link"`                    // URL or IPFS link to the file
+	DirectoryUUID *string    `json:"directoryUuid,omitempty"` // UUID of the parent directory (nullable)
 }
 
 // BucketItem contains information about a storage bucket.
 type BucketItem struct {
 	Timestamps
-	BucketUUID  string `json:"bucketUuid"`  // Unique identifier for the bucket
-	BucketType  int    `json:"bucketType"`  // Type of the bucket
-	Name        string `json:"name"`        // Name of the bucket
-	Description string `json:"description"` // Description of the bucket
-	Size        int64  `json:"size"`        // Total size of the bucket in bytes
+	BucketUUID  string     `json:"bucketUuid"`  // Unique identifier for the bucket
+	BucketType  BucketType `json:"bucketType"`  // Type of the bucket
+	Name        string     `json:"name"`        // Name of the bucket
+	Description string     `json:"description"` // Description of the bucket
+	Size        int64      `json:"size"`        // Total size of the bucket in bytes
+}
+
+// UploadOptions configures the behaviour of UploadFileProcessWithOptions.
+// The zero value matches UploadFileProcess.
+type UploadOptions struct {
+	// JournalPath is the file used to record upload progress. When set, an interrupted
+	// upload resumes the recorded session and only sends the files that are still missing.
+	JournalPath string
+	// JournalURLTTL is how long signed URLs recorded in the journal are trusted.
+	// Defaults to DefaultJournalURLTTL.
+	JournalURLTTL time.Duration
+	// ContentTypeFunc overrides the content type of individual files. Files it returns an
+	// empty string for keep their ContentType, or have it detected when that is empty.
+	ContentTypeFunc ContentTypeFunc
+	// MaxFilesPerSession limits how many files one upload session contains.
+	// Defaults to DefaultMaxFilesPerSession.
+	MaxFilesPerSession int
+	// MaxBytesPerSession limits the total content size of one upload session. Zero means no limit.
+	MaxBytesPerSession int64
+	// SessionConcurrency is how many sessions are uploaded at the same time. Defaults to 1.
+	SessionConcurrency int
+	// Encryption, when set, encrypts every file with AES-256-GCM before it is uploaded.
+	// Use DownloadDecrypted to read the files back.
+	Encryption KeyProvider
+	// Compression, when set, compresses files with eligible content types before they are
+	// encrypted and uploaded. Use DownloadDecompressed to read the files back.
+	Compression *CompressionOptions
+	// Manifest, when set, writes a manifest of the uploaded files after a successful upload.
+	// Use LoadManifest and VerifyManifest to check the bucket against it later.
+	Manifest *ManifestOptions
+	// PreUpload hooks run in order on every file after its content type is resolved and before it
+	// is compressed, encrypted or uploaded.
+	PreUpload []PreUploadHook
+	// PostUpload hooks run in order after each file is uploaded to its signed URL.
+	PostUpload []PostUploadHook
 }
 
 type startUploadRequest struct {
@@ -4,29 +4,36 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/LeonardoRyuta/apillon-storage/requests"
 )
 
 // StartUploadFilesToBucket initiates an upload session for a set of files in a given bucket.
-// It sends file metadata to the Apillon API and returns the raw API response or an error.
-func StartUploadFilesToBucket(bucketUuid string, files []FileMetadata) (string, error) {
+// Files without a content type get one based on their extension, or "application/octet-stream".
+// It sends file metadata to the Apillon API and returns the started Session, with a signed URL and
+// file UUID for each file in the order they were given, or an error.
+func StartUploadFilesToBucket(bucketUuid string, files []FileMetadata) (Session, error) {
 	if bucketUuid == "" {
-		return "", fmt.Errorf("bucket uuid is required")
+		return Session{}, fmt.Errorf("bucket uuid is required")
 	}
 	if len(files) == 0 {
-		return "", fmt.Errorf("at least one file must be provided")
+		return Session{}, fmt.Errorf("at least one file must be provided")
 	}
 	// Ensure each file has a content type
 	for i := range files {
 		if files[i].ContentType == "" {
-			files[i].ContentType = "text/plain"
+			files[i].ContentType = ContentTypeByExtension(files[i].FileName)
+		}
+		if files[i].ContentType == "" {
+			files[i].ContentType = defaultContentType
 		}
 	}
 
@@ -34,7 +41,7 @@ func StartUploadFilesToBucket(bucketUuid string, files []FileMetadata) (string,
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		log.Printf("Failed to marshal start upload session request for bucket %s: %v", bucketUuid, err)
-		return "", err
+		return Session{}, err
 	}
 
 	path := "/storage/buckets/" + bucketUuid + "/upload"
@@ -42,14 +49,21 @@ func StartUploadFilesToBucket(bucketUuid string, files []FileMetadata) (string,
 	res, err := requests.PostReq(path, strings.NewReader(string(bodyBytes)))
 	if err != nil {
 		log.Printf("Failed to start upload session for bucket %s via /upload endpoint: %v", bucketUuid, err)
-		return "", err
+		return Session{}, err
+	}
+
+	var apiResp ProcessAPIResponse
+	if errUnmarshal := json.Unmarshal([]byte(res), &apiResp); errUnmarshal != nil {
+		log.Printf("Failed to unmarshal JSON response from start upload for bucket %s: %v. Raw response: %s", bucketUuid, errUnmarshal, res)
+		return Session{}, fmt.Errorf("failed to unmarshal start upload response: %w. Raw response: %s", errUnmarshal, res)
 	}
 
-	log.Printf("Upload session started successfully for bucket %s: %s", bucketUuid, res)
-	return res, nil
+	log.Printf("Upload session %s started successfully for bucket %s with %d files", apiResp.Data.SessionUUID, bucketUuid, len(apiResp.Data.Files))
+	return Session{BucketUUID: bucketUuid, SessionUUID: apiResp.Data.SessionUUID, Files: apiResp.Data.Files}, nil
 }
 
 // UploadFiles uploads a file's raw content to a signed URL using HTTP PUT.
+// The transfer counts towards the limit set with SetBandwidthLimit.
 // Returns a success message or an error if the upload fails.
 func UploadFiles(signedURL string, rawFile string) (string, error) {
 	if signedURL == "" {
@@ -60,11 +74,12 @@ func UploadFiles(signedURL string, rawFile string) (string, error) {
 	}
 	client := &http.Client{}
 
-	req, err := http.NewRequest(http.MethodPut, signedURL, strings.NewReader(rawFile))
+	req, err := http.NewRequest(http.MethodPut, signedURL, throttle(strings.NewReader(rawFile)))
 	if err != nil {
 		log.Printf("Failed to create request for signed URL %s: %v", signedURL, err)
 		return "", err
 	}
+	req.ContentLength = int64(len(rawFile)) // Signed URLs do not accept chunked uploads
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -85,10 +100,10 @@ func UploadFiles(signedURL string, rawFile string) (string, error) {
 }
 
 // EndSession finalizes an upload session for a given bucket and session ID.
-// Returns the API response or an error.
-func EndSession(bucketUuid string, sessionId string) (string, error) {
+// Returns the parsed API response or an error.
+func EndSession(bucketUuid string, sessionId string) (EndSessionResponse, error) {
 	if bucketUuid == "" || sessionId == "" {
-		return "", fmt.Errorf("bucket uuid and session id are required")
+		return EndSessionResponse{}, fmt.Errorf("bucket uuid and session id are required")
 	}
 
 	path := "/storage/buckets/" + bucketUuid + "/upload/" + sessionId + "/end"
@@ -96,95 +111,360 @@ func EndSession(bucketUuid string, sessionId string) (string, error) {
 	res, err := requests.PostReq(path, nil)
 	if err != nil {
 		log.Printf("Failed to end session for bucket %s: %v", bucketUuid, err)
-		return "", err
+		return EndSessionResponse{}, err
+	}
+
+	var resp EndSessionResponse
+	if errUnmarshal := json.Unmarshal([]byte(res), &resp); errUnmarshal != nil {
+		log.Printf("Failed to unmarshal JSON response from end session for bucket %s: %v. Raw response: %s", bucketUuid, errUnmarshal, res)
+		return EndSessionResponse{}, fmt.Errorf("failed to unmarshal end session response: %w. Raw response: %s", errUnmarshal, res)
 	}
 
-	log.Printf("Session ended successfully for bucket %s: %s", bucketUuid, res)
-	return res, nil
+	log.Printf("Session %s ended successfully for bucket %s", sessionId, bucketUuid)
+	return resp, nil
 }
 
+// DefaultMaxFilesPerSession is the default number of files sent in a single upload session.
+const DefaultMaxFilesPerSession = 200
+
+// signedURLDelay is how long to wait after a session is started before its signed URLs are used.
+var signedURLDelay = 2 * time.Second
+
 // UploadFileProcess orchestrates the full upload process for multiple files:
 // 1. Starts an upload session and retrieves signed URLs.
 // 2. Uploads each file to its corresponding signed URL.
 // 3. Ends the upload session.
-// Returns the final API response or an error.
-func UploadFileProcess(bucketUuid string, files []WholeFile) (string, error) {
+// Returns an UploadResult describing every file, or an error.
+func UploadFileProcess(bucketUuid string, files []WholeFile) (UploadResult, error) {
+	return UploadFileProcessWithOptions(bucketUuid, files, UploadOptions{})
+}
+
+// UploadFileProcessWithOptions runs the same upload process as UploadFileProcess, configured by opts.
+//
+// When opts.JournalPath is set, the session UUID, signed URLs and per-file completion are recorded
+// in that file. Rerunning the upload with the same files resumes the recorded session and only sends
+// the missing files. If the recorded signed URLs are older than opts.JournalURLTTL, the old session is
+// ended for the files that did complete and a new session is started for the rest.
+// The journal is removed once every file has been uploaded and all sessions are ended.
+//
+// Large file sets are split into several sessions of at most opts.MaxFilesPerSession files and
+// opts.MaxBytesPerSession bytes, uploaded opts.SessionConcurrency sessions at a time. A failing session
+// does not stop the others; the errors of all failed sessions are joined into the returned error, and
+// the returned UploadResult records which files were uploaded and why the others failed.
+//
+// Files without a content type have it detected from their extension or content (see DetectContentType),
+// and opts.ContentTypeFunc can override the content type per file. With opts.Compression, eligible files
+// are compressed and stored with CompressionMarker and the compressor's extension appended to their name. With opts.Encryption,
+// files are then encrypted client-side before upload and stored as "application/octet-stream".
+// opts.PreUpload hooks can transform, skip or reject each file before anything is uploaded, and
+// opts.PostUpload hooks are called with each file once it has been sent to its signed URL; a failing hook
+// is reported for its file but does not stop the upload or keep its session from being ended.
+// With opts.Manifest, a JSON and/or CSV manifest of the uploaded files is written once every file is uploaded.
+// Returns an UploadResult with the name, path, UUID, size, upload duration and error of each file,
+// or an error. Names and sizes are those of the stored files, after compression and encryption.
+func UploadFileProcessWithOptions(bucketUuid string, files []WholeFile, opts UploadOptions) (UploadResult, error) {
 	if bucketUuid == "" {
-		return "", fmt.Errorf("bucket uuid is required")
+		return UploadResult{}, fmt.Errorf("bucket uuid is required")
 	}
 	if len(files) == 0 {
-		return "", fmt.Errorf("no files provided for upload")
+		return UploadResult{}, fmt.Errorf("no files provided for upload")
 	}
-
-	// Extract only the metadata for the upload session initiation
-	onlyMetadata := make([]FileMetadata, len(files))
-	for i, file := range files {
+	for _, file := range files {
 		if file.Content == "" || file.Metadata.FileName == "" {
 			log.Printf("File content or metadata is empty for file %s in bucket %s", file.Metadata.FileName, bucketUuid)
-			return "", fmt.Errorf("file content or metadata is empty for file %s in bucket %s", file.Metadata.FileName, bucketUuid)
+			return UploadResult{}, fmt.Errorf("file content or metadata is empty for file %s in bucket %s", file.Metadata.FileName, bucketUuid)
 		}
-		onlyMetadata[i] = file.Metadata
 	}
 
-	// Step 1: Start upload session and get signed URLs
-	res, err := StartUploadFilesToBucket(bucketUuid, onlyMetadata)
+	start := time.Now()
+	files = resolveContentTypes(files, opts.ContentTypeFunc)
+
+	files, skipped, err := runPreUploadHooks(files, opts.PreUpload)
 	if err != nil {
-		log.Printf("Failed to start upload session for bucket %s: %v", bucketUuid, err)
-		return "", fmt.Errorf("failed to start upload session for bucket %s: %w", bucketUuid, err)
+		return UploadResult{}, err
+	}
+	if len(files) == 0 {
+		log.Printf("All files for bucket %s were skipped by pre-upload hooks", bucketUuid)
+		return UploadResult{BucketUUID: bucketUuid, Skipped: skipped, Duration: time.Since(start)}, nil
 	}
 
-	var apiResp ProcessAPIResponse
-	if errUnmarshal := json.Unmarshal([]byte(res), &apiResp); errUnmarshal != nil {
-		log.Printf("Failed to unmarshal JSON response from process upload for bucket %s: %v. Raw response: %s", bucketUuid, errUnmarshal, res)
-		return "", fmt.Errorf("failed to unmarshal process upload response: %w. Raw response: %s", errUnmarshal, res)
+	journal, err := openJournal(opts.JournalPath, bucketUuid, files)
+	if err != nil {
+		return UploadResult{}, err
 	}
 
-	// Extract signed URLs from API response
-	var urls []string
-	if apiResp.Data.Files != nil {
-		for _, fileItem := range apiResp.Data.Files {
-			if fileItem.URL != "" {
-				urls = append(urls, fileItem.URL)
+	files, err = compressFiles(files, opts.Compression)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	files, err = encryptFiles(files, opts.Encryption)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	ttl := opts.JournalURLTTL
+	if ttl <= 0 {
+		ttl = DefaultJournalURLTTL
+	}
+
+	// Step 1: Retire sessions whose signed URLs can no longer be trusted
+	for _, sessionUuid := range journal.openSessions() {
+		if time.Since(journal.session(sessionUuid).StartedAt) < ttl {
+			continue
+		}
+		log.Printf("Signed URLs of session %s for bucket %s have expired, starting a new session", sessionUuid, bucketUuid)
+		if err := retireSession(bucketUuid, journal, sessionUuid); err != nil {
+			return UploadResult{}, err
+		}
+	}
+
+	// Step 2: Resume the open sessions and batch the remaining files into new sessions
+	var batches []sessionBatch
+	for _, sessionUuid := range journal.openSessions() {
+		batches = append(batches, sessionBatch{sessionUuid: sessionUuid, files: journal.filesInSession(sessionUuid)})
+	}
+	for _, idx := range splitBatches(files, journal.unassigned(), opts) {
+		batches = append(batches, sessionBatch{files: idx})
+	}
+	if len(batches) > 1 {
+		log.Printf("Uploading %d files to bucket %s in %d sessions", len(files), bucketUuid, len(batches))
+	}
+
+	// Step 3: Upload the missing files of each session and end it
+	concurrency := opts.SessionConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	results := make([]FileResult, len(files))
+	errs := make([]error, len(batches))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for n := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(n int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[n] = uploadBatch(bucketUuid, files, journal, batches[n], results, opts.PostUpload)
+		}(n)
+	}
+	wg.Wait()
+
+	result := UploadResult{BucketUUID: bucketUuid, Files: results, Skipped: skipped}
+	for i, file := range files {
+		results[i].FileName = file.Metadata.FileName
+		results[i].Path = file.Metadata.Path
+		results[i].Size = int64(len(file.Content))
+		results[i].FileUUID = journal.Files[i].FileUUID
+		results[i].SessionUUID = journal.Files[i].SessionUUID
+	}
+	for n, batch := range batches {
+		for _, i := range batch.files {
+			if errs[n] != nil && results[i].Err == nil && !journal.committed(i) {
+				results[i].Err = errs[n]
 			}
 		}
 	}
-	if len(urls) == 0 {
-		log.Printf("No URLs found in process upload response for bucket %s", bucketUuid)
-		return "", fmt.Errorf("no URLs found in process upload response for bucket %s", bucketUuid)
+	result.Duration = time.Since(start)
+
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("Failed to upload files to bucket %s: %v", bucketUuid, err)
+		return result, err
 	}
 
-	log.Printf("Extracted URLs from process upload response for bucket %s: %v", bucketUuid, urls)
+	journal.remove()
 
-	time.Sleep(2 * time.Second) // Wait for the URLs to be ready
+	if opts.Manifest != nil {
+		if err := writeManifest(bucketUuid, files, result, opts.Manifest); err != nil {
+			log.Printf("Failed to write manifest for bucket %s: %v", bucketUuid, err)
+			return result, err
+		}
+	}
 
-	// Step 2: Upload each file to its signed URL
-	for i, file := range files {
-		if i >= len(urls) {
-			log.Printf("Not enough URLs provided for the number of files. Expected %d URLs, got %d", len(files), len(urls))
-			return "", fmt.Errorf("not enough URLs provided for the number of files. Expected %d URLs, got %d", len(files), len(urls))
+	log.Printf("%d files processed successfully for bucket %s in %v", len(files), bucketUuid, result.Duration)
+	return result, nil
+}
+
+// sessionBatch is a group of files uploaded in one session. An empty sessionUuid means
+// the session still has to be started.
+type sessionBatch struct {
+	sessionUuid string
+	files       []int
+}
+
+// splitBatches groups the files at idx into batches that respect the per-session file count and
+// byte limits in opts. A single file larger than the byte limit gets a batch of its own.
+func splitBatches(files []WholeFile, idx []int, opts UploadOptions) [][]int {
+	maxFiles := opts.MaxFilesPerSession
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFilesPerSession
+	}
+
+	var batches [][]int
+	var current []int
+	var size int64
+	for _, i := range idx {
+		fileSize := int64(len(files[i].Content))
+		full := len(current) >= maxFiles || (opts.MaxBytesPerSession > 0 && size+fileSize > opts.MaxBytesPerSession)
+		if len(current) > 0 && full {
+			batches = append(batches, current)
+			current, size = nil, 0
 		}
-		signedURL := urls[i]
-		rawFile := file.Content
-		if rawFile == "" {
-			log.Printf("File content is empty for file %s in bucket %s", file.Metadata.FileName, bucketUuid)
-			return "", fmt.Errorf("file content is empty for file %s in bucket %s", file.Metadata.FileName, bucketUuid)
+		current = append(current, i)
+		size += fileSize
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// uploadBatch starts the batch's session if needed, uploads its missing files and ends the session.
+// The upload duration of each file, and the error of a file that failed, are recorded in results.
+// hooks run after each file is uploaded, before it is marked done in the journal. A failing hook does
+// not stop the batch: the file is still marked done, the session is ended, and the hook errors are
+// returned joined once the session is ended.
+func uploadBatch(bucketUuid string, files []WholeFile, journal *uploadJournal, batch sessionBatch, results []FileResult, hooks []PostUploadHook) error {
+	if batch.sessionUuid == "" {
+		metadata := make([]FileMetadata, len(batch.files))
+		for n, i := range batch.files {
+			metadata[n] = files[i].Metadata
 		}
 
-		uploadRes, err := UploadFiles(signedURL, rawFile)
+		session, err := startSession(bucketUuid, metadata)
 		if err != nil {
-			log.Printf("Failed to upload file %s to signed URL %s for bucket %s: %v", file.Metadata.FileName, signedURL, bucketUuid, err)
-			return "", fmt.Errorf("failed to upload file %s to signed URL %s for bucket %s: %w", file.Metadata.FileName, signedURL, bucketUuid, err)
+			return err
+		}
+		if err := journal.assign(session, batch.files, metadata); err != nil {
+			log.Printf("Failed to assign signed URLs for bucket %s: %v", bucketUuid, err)
+			return err
 		}
-		log.Printf("File %s uploaded successfully to signed URL %s for bucket %s: %s", file.Metadata.FileName, signedURL, bucketUuid, uploadRes)
+		batch.sessionUuid = session.SessionUUID
+
+		time.Sleep(signedURLDelay) // Wait for the URLs to be ready
 	}
 
-	// Step 3: End the upload session
-	res, err = EndSession(bucketUuid, apiResp.Data.SessionUUID)
+	var hookErrs []error
+	for _, i := range batch.files {
+		entry := journal.Files[i]
+		if entry.Done {
+			continue
+		}
+
+		file := files[i]
+		start := time.Now()
+		uploadRes, err := UploadFiles(entry.URL, file.Content)
+		results[i].Duration = time.Since(start)
+		if err != nil {
+			log.Printf("Failed to upload file %s to signed URL %s for bucket %s: %v", file.Metadata.FileName, entry.URL, bucketUuid, err)
+			results[i].Err = err
+			return fmt.Errorf("failed to upload file %s to signed URL %s for bucket %s: %w", file.Metadata.FileName, entry.URL, bucketUuid, err)
+		}
+		log.Printf("File %s uploaded successfully to signed URL %s for bucket %s: %s", file.Metadata.FileName, entry.URL, bucketUuid, uploadRes)
+
+		item := FileItem{
+			FileName:    file.Metadata.FileName,
+			ContentType: file.Metadata.ContentType,
+			URL:         entry.URL,
+			FileUUID:    entry.FileUUID,
+		}
+		if file.Metadata.Path != "" {
+			item.Path = &file.Metadata.Path
+		}
+		// The file is already stored, so a failing hook must not keep the session from being ended
+		if err := runPostUploadHooks(item, hooks); err != nil {
+			log.Printf("Post-upload hook failed for file %s in bucket %s: %v", file.Metadata.FileName, bucketUuid, err)
+			results[i].Err = fmt.Errorf("post-upload hook failed for file %s in bucket %s: %w", file.Metadata.FileName, bucketUuid, err)
+			hookErrs = append(hookErrs, results[i].Err)
+		}
+
+		if err := journal.markDone(i); err != nil {
+			return err
+		}
+	}
+
+	if _, err := EndSession(bucketUuid, batch.sessionUuid); err != nil {
+		log.Printf("Failed to end session %s for bucket %s: %v", batch.sessionUuid, bucketUuid, err)
+		return errors.Join(append([]error{fmt.Errorf("failed to end session %s for bucket %s: %w", batch.sessionUuid, bucketUuid, err)}, hookErrs...)...)
+	}
+	if err := journal.markEnded(batch.sessionUuid, false); err != nil {
+		return errors.Join(append([]error{err}, hookErrs...)...)
+	}
+	return errors.Join(hookErrs...)
+}
+
+// DirectoryOptions configures UploadDirectory.
+type DirectoryOptions struct {
+	RemotePath string        // Directory in the bucket the files are uploaded to; defaults to the bucket root
+	Ignore     IgnoreOptions // Files to leave out of the upload
+	Upload     UploadOptions // Options for the upload process
+}
+
+// UploadDirectory uploads every file below localDir, keeping the directory structure under
+// opts.RemotePath. Files matched by the directory's .apillonignore file or opts.Ignore are skipped.
+// Returns an UploadResult describing every file, or an error.
+func UploadDirectory(localDir string, bucketUuid string, opts DirectoryOptions) (UploadResult, error) {
+	if localDir == "" {
+		return UploadResult{}, fmt.Errorf("local directory is required")
+	}
+
+	filter, err := newLocalFilter(localDir, opts.Ignore)
 	if err != nil {
-		log.Printf("Failed to end session for bucket %s: %v", bucketUuid, err)
-		return "", fmt.Errorf("failed to end session for bucket %s: %w", bucketUuid, err)
+		return UploadResult{}, err
+	}
+
+	files, err := readLocalDirectory(localDir, strings.Trim(opts.RemotePath, "/"), filter)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if len(files) == 0 {
+		return UploadResult{}, fmt.Errorf("no files to upload in %s", localDir)
+	}
+
+	log.Printf("Uploading %d files from %s to bucket %s", len(files), localDir, bucketUuid)
+	return UploadFileProcessWithOptions(bucketUuid, files, opts.Upload)
+}
+
+// startSession starts an upload session for the given files and checks every file got a signed URL.
+func startSession(bucketUuid string, metadata []FileMetadata) (Session, error) {
+	session, err := StartUploadFilesToBucket(bucketUuid, metadata)
+	if err != nil {
+		log.Printf("Failed to start upload session for bucket %s: %v", bucketUuid, err)
+		return Session{}, fmt.Errorf("failed to start upload session for bucket %s: %w", bucketUuid, err)
+	}
+
+	for _, fileItem := range session.Files {
+		if fileItem.URL == "" {
+			log.Printf("Missing signed URL for file %s in process upload response for bucket %s", fileItem.FileName, bucketUuid)
+			return Session{}, fmt.Errorf("missing signed URL for file %s in process upload response for bucket %s", fileItem.FileName, bucketUuid)
+		}
+	}
+	if len(session.Files) == 0 {
+		log.Printf("No URLs found in process upload response for bucket %s", bucketUuid)
+		return Session{}, fmt.Errorf("no URLs found in process upload response for bucket %s", bucketUuid)
+	}
+
+	log.Printf("Started upload session %s for bucket %s with %d signed URLs", session.SessionUUID, bucketUuid, len(session.Files))
+	return session, nil
+}
+
+// retireSession stops using a session recorded in the journal. Files that were already uploaded
+// are committed by ending the session; the remaining files are released so they get a new session.
+func retireSession(bucketUuid string, journal *uploadJournal, sessionUuid string) error {
+	uploaded := false
+	for _, i := range journal.filesInSession(sessionUuid) {
+		if journal.Files[i].Done {
+			uploaded = true
+			break
+		}
+	}
+
+	if uploaded {
+		if _, err := EndSession(bucketUuid, sessionUuid); err != nil {
+			log.Printf("Failed to end expired session %s for bucket %s: %v", sessionUuid, bucketUuid, err)
+			return fmt.Errorf("failed to end expired session %s for bucket %s: %w", sessionUuid, bucketUuid, err)
+		}
 	}
 
-	log.Printf("Files processed successfully for bucket %s: %s", bucketUuid, res)
-	return res, nil
+	return journal.markEnded(sessionUuid, true)
 }
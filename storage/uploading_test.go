@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestSplitBatches(t *testing.T) {
+	files := []WholeFile{
+		{Content: strings.Repeat("a", 4)},
+		{Content: strings.Repeat("b", 4)},
+		{Content: strings.Repeat("c", 10)},
+		{Content: strings.Repeat("d", 1)},
+		{Content: strings.Repeat("e", 1)},
+		{Content: strings.Repeat("f", 1)},
+	}
+	idx := []int{0, 1, 2, 3, 4, 5}
+
+	got := splitBatches(files, idx, UploadOptions{MaxFilesPerSession: 2, MaxBytesPerSession: 8})
+	want := [][]int{{0, 1}, {2}, {3, 4}, {5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitBatches = %v, want %v", got, want)
+	}
+}
+
+func TestUploadFileProcessWithOptions_ConcurrentSessions(t *testing.T) {
+	defer gock.Off()
+	defer func(d time.Duration) { signedURLDelay = d }(signedURLDelay)
+	signedURLDelay = 0
+
+	bucketUUID := "test-bucket-uuid"
+	files := []WholeFile{
+		{Metadata: FileMetadata{FileName: "a.txt"}, Content: "a"},
+		{Metadata: FileMetadata{FileName: "b.txt"}, Content: "b"},
+		{Metadata: FileMetadata{FileName: "c.txt"}, Content: "c"},
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		gock.New("https://api.apillon.io").
+			Post("/storage/buckets/" + bucketUUID + "/upload$").
+			BodyString(`"fileName":"` + name + `.txt"`).
+			Reply(200).
+			JSON(map[string]any{"data": map[string]any{
+				"sessionUuid": "session-" + name,
+				"files":       []map[string]any{{"fileName": name + ".txt", "url": "https://s3.example.com/" + name, "fileUuid": "file-" + name}},
+			}})
+	}
+	gock.New("https://s3.example.com").Put("/a").Reply(200)
+	gock.New("https://s3.example.com").Put("/b").Reply(500).BodyString("boom")
+	gock.New("https://s3.example.com").Put("/c").Reply(200)
+	gock.New("https://api.apillon.io").Post("/upload/session-a/end").Reply(200).JSON(map[string]any{"data": true})
+	gock.New("https://api.apillon.io").Post("/upload/session-c/end").Reply(200).JSON(map[string]any{"data": true})
+
+	result, err := UploadFileProcessWithOptions(bucketUUID, files, UploadOptions{MaxFilesPerSession: 1, SessionConcurrency: 3})
+	if err == nil || !strings.Contains(err.Error(), "b.txt") {
+		t.Fatalf("expected the failed session to be reported, got %v", err)
+	}
+	if strings.Contains(err.Error(), "a.txt") || strings.Contains(err.Error(), "c.txt") {
+		t.Errorf("successful sessions should not be reported as errors: %v", err)
+	}
+	if !gock.IsDone() {
+		t.Errorf("expected all sessions to run despite the failure")
+	}
+
+	if len(result.Files) != 3 {
+		t.Fatalf("expected a result for every file, got %+v", result.Files)
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		f := result.Files[i]
+		if f.FileName != name+".txt" || f.FileUUID != "file-"+name || f.SessionUUID != "session-"+name || f.Size != 1 {
+			t.Errorf("unexpected result for %s: %+v", name, f)
+		}
+	}
+	if failed := result.Failed(); len(failed) != 1 || failed[0].FileName != "b.txt" {
+		t.Errorf("Failed() = %+v, want only b.txt", failed)
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+)
+
+// ErrCIDMismatch is returned when the CID computed locally differs from the CID reported by Apillon.
+var ErrCIDMismatch = errors.New("cid mismatch")
+
+// CIDVerification describes the outcome of comparing local content with an uploaded file.
+type CIDVerification struct {
+	FileUUID  string // Unique identifier for the file
+	RemoteCID string // CID reported by Apillon
+	LocalCID  string // CID computed locally, in the same version as RemoteCID
+	Match     bool   // Whether the content matches
+}
+
+// ComputeCIDs returns the CIDv0 and CIDv1 of content using the `ipfs add` defaults.
+// The content is read twice, so it is rewound before each pass.
+func ComputeCIDs(content io.ReadSeeker) (cid.Cid, cid.Cid, error) {
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return cid.Cid{}, cid.Cid{}, err
+	}
+	v0, err := cid.FromReader(content, cid.V0())
+	if err != nil {
+		return cid.Cid{}, cid.Cid{}, err
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return cid.Cid{}, cid.Cid{}, err
+	}
+	v1, err := cid.FromReader(content, cid.V1())
+	if err != nil {
+		return cid.Cid{}, cid.Cid{}, err
+	}
+	return v0, v1, nil
+}
+
+// VerifyUpload checks that the file stored in a bucket has exactly the given content.
+// It computes the CID of content locally and compares it with the CID field returned by GetFileDetails,
+// accepting either the CIDv0 DAG (in v0 or v1 form) or the raw-leaf CIDv1 DAG.
+// Returns the verification details, and an error wrapping ErrCIDMismatch if the content differs.
+func VerifyUpload(bucketUuid string, fileUuid string, content io.ReadSeeker) (CIDVerification, error) {
+	details, err := GetFileDetails(bucketUuid, fileUuid)
+	if err != nil {
+		return CIDVerification{}, err
+	}
+
+	result := CIDVerification{FileUUID: fileUuid, RemoteCID: details.Data.CID}
+	if result.RemoteCID == "" {
+		return result, fmt.Errorf("file %s in bucket %s has no CID yet", fileUuid, bucketUuid)
+	}
+
+	remote, err := cid.Parse(result.RemoteCID)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse CID of file %s in bucket %s: %w", fileUuid, bucketUuid, err)
+	}
+
+	v0, v1, err := ComputeCIDs(content)
+	if err != nil {
+		return result, fmt.Errorf("failed to compute CID for file %s: %w", fileUuid, err)
+	}
+
+	result.Match = cidMatches(remote, v0, v1)
+	switch {
+	case remote.SameBlock(v0) && remote.Version == 1:
+		result.LocalCID = v0.ToV1().String()
+	case remote.Version == 1:
+		result.LocalCID = v1.String()
+	default:
+		result.LocalCID = v0.String()
+	}
+
+	if !result.Match {
+		log.Printf("CID mismatch for file %s in bucket %s: remote %s, local %s", fileUuid, bucketUuid, result.RemoteCID, result.LocalCID)
+		return result, fmt.Errorf("%w for file %s in bucket %s: remote %s, local %s", ErrCIDMismatch, fileUuid, bucketUuid, result.RemoteCID, result.LocalCID)
+	}
+
+	log.Printf("Verified file %s in bucket %s with CID %s", fileUuid, bucketUuid, result.RemoteCID)
+	return result, nil
+}
+
+// cidMatches reports whether a remote CID references the DAG of either locally computed CID.
+// The CIDv0 DAG matches in v0 or v1 form, the raw-leaf CIDv1 DAG only as an exact CID.
+func cidMatches(remote cid.Cid, v0 cid.Cid, v1 cid.Cid) bool {
+	return remote.SameBlock(v0) || remote.Equals(v1)
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LeonardoRyuta/apillon-storage/cid"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestVerifyUpload(t *testing.T) {
+	const (
+		helloV0 = "Qmf412jQZiuVUtdgnB36FXFX7xg5V6KEbSJ4dpQuhkLyfD"
+		helloV1 = "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"
+		otherV0 = "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"
+	)
+	v0, err := cid.Parse(helloV0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherV1, err := cid.FromBytes([]byte("hello world\n"), cid.V1())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		match     bool
+		wantLocal string
+	}{
+		{"V0", helloV0, true, helloV0},
+		{"V0DagAsV1", v0.ToV1().String(), true, v0.ToV1().String()},
+		{"RawLeafV1", helloV1, true, helloV1},
+		{"MismatchV0", otherV0, false, helloV0},
+		{"MismatchV1", otherV1.String(), false, helloV1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gock.Off()
+
+			bucketUUID := "test-bucket-uuid"
+			gock.New("https://api.apillon.io").
+				Get("/storage/buckets/" + bucketUUID + "/files/file-1").
+				Reply(200).
+				JSON(map[string]any{"status": 200, "data": map[string]any{"fileUuid": "file-1", "name": "hello.txt", "CID": tt.remote}})
+
+			result, err := VerifyUpload(bucketUUID, "file-1", strings.NewReader("hello world"))
+			if tt.match && err != nil {
+				t.Fatalf("VerifyUpload returned error: %v", err)
+			}
+			if !tt.match && !errors.Is(err, ErrCIDMismatch) {
+				t.Fatalf("VerifyUpload error = %v, want ErrCIDMismatch", err)
+			}
+			if result.Match != tt.match || result.RemoteCID != tt.remote || result.LocalCID != tt.wantLocal {
+				t.Errorf("unexpected verification %+v", result)
+			}
+		})
+	}
+}
+
+func TestVerifyUpload_NoCID(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/" + bucketUUID + "/files/file-1").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"fileUuid": "file-1", "name": "hello.txt"}})
+
+	if _, err := VerifyUpload(bucketUUID, "file-1", strings.NewReader("hello world")); err == nil || errors.Is(err, ErrCIDMismatch) {
+		t.Errorf("expected an error for a file without a CID, got %v", err)
+	}
+}
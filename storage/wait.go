@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WaitOptions configures how WaitForFiles polls for file processing.
+type WaitOptions struct {
+	Timeout         time.Duration // Maximum time to wait; defaults to 5 minutes
+	InitialInterval time.Duration // Delay before the second poll; defaults to 2 seconds
+	MaxInterval     time.Duration // Upper bound for the backoff delay; defaults to 30 seconds
+}
+
+// withDefaults fills in the defaults of unset options.
+func (o WaitOptions) withDefaults() WaitOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Minute
+	}
+	if o.InitialInterval <= 0 {
+		o.InitialInterval = 2 * time.Second
+	}
+	if o.MaxInterval <= 0 {
+		o.MaxInterval = 30 * time.Second
+	}
+	return o
+}
+
+// FailedFile describes a file that will never finish processing.
+type FailedFile struct {
+	FileUUID string // Unique identifier for the file
+	Reason   string // Why the file is considered failed
+}
+
+// WaitError is returned by WaitForFiles when files failed or did not finish in time.
+type WaitError struct {
+	TimedOut bool         // Whether the timeout elapsed before all files finished
+	Pending  []FileInfo   // Files that were still being processed
+	Failed   []FailedFile // Files that failed processing
+}
+
+func (e *WaitError) Error() string {
+	var parts []string
+	if e.TimedOut {
+		uuids := make([]string, len(e.Pending))
+		for i, f := range e.Pending {
+			uuids[i] = fmt.Sprintf("%s (%s)", f.FileUUID, f.FileStatus)
+		}
+		parts = append(parts, fmt.Sprintf("timed out waiting for %d file(s): %s", len(e.Pending), strings.Join(uuids, ", ")))
+	}
+	if len(e.Failed) > 0 {
+		failed := make([]string, len(e.Failed))
+		for i, f := range e.Failed {
+			failed[i] = f.FileUUID + ": " + f.Reason
+		}
+		parts = append(parts, fmt.Sprintf("%d file(s) failed: %s", len(e.Failed), strings.Join(failed, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// WaitForFiles polls Apillon until every file is pinned and has a CID.
+// Files are selected either by the session they were uploaded in or by their UUIDs; when
+// sessionUuid is set, fileUuids is ignored. Polling backs off exponentially between
+// opts.InitialInterval and opts.MaxInterval until opts.Timeout elapses.
+//
+// Returns the latest FileInfo for every file. If some files failed or the timeout elapsed, the
+// available results are returned together with a *WaitError describing the affected files.
+func WaitForFiles(bucketUuid string, sessionUuid string, fileUuids []string, opts WaitOptions) ([]FileInfo, error) {
+	if bucketUuid == "" {
+		return nil, fmt.Errorf("bucket uuid is required")
+	}
+	if sessionUuid == "" && len(fileUuids) == 0 {
+		return nil, fmt.Errorf("session uuid or file uuids are required")
+	}
+
+	opts = opts.withDefaults()
+	deadline := time.Now().Add(opts.Timeout)
+	interval := opts.InitialInterval
+	seen := map[string]bool{} // Session files listed by earlier polls
+
+	for {
+		files, failed, err := pollFiles(bucketUuid, sessionUuid, fileUuids, seen)
+		if err != nil {
+			log.Printf("Failed to poll file status for bucket %s, retrying: %v", bucketUuid, err)
+		}
+
+		var pending []FileInfo
+		if err == nil {
+			for _, f := range files {
+				if !f.FileStatus.IsPinned() || f.CID == "" {
+					pending = append(pending, f)
+				}
+			}
+			if len(pending) == 0 {
+				if len(failed) > 0 {
+					return files, &WaitError{Failed: failed}
+				}
+				log.Printf("All %d file(s) in bucket %s finished processing", len(files), bucketUuid)
+				return files, nil
+			}
+			log.Printf("Waiting for %d of %d file(s) in bucket %s to finish processing", len(pending), len(files), bucketUuid)
+		}
+
+		if !sleepUntilNextPoll(deadline, interval) {
+			if err != nil {
+				return files, fmt.Errorf("timed out waiting for files in bucket %s: %w", bucketUuid, err)
+			}
+			return files, &WaitError{TimedOut: true, Pending: pending, Failed: failed}
+		}
+		interval = min(interval*2, opts.MaxInterval)
+	}
+}
+
+// sleepUntilNextPoll sleeps for interval, or for the time left before deadline if that is shorter,
+// so that the last poll happens at the deadline. Returns false without sleeping once the deadline has passed.
+func sleepUntilNextPoll(deadline time.Time, interval time.Duration) bool {
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return false
+	}
+	time.Sleep(min(interval, remaining))
+	return true
+}
+
+// pollFiles fetches the current state of the files being waited on.
+// Files that no longer exist are reported as failed instead of being returned. In session mode,
+// seen holds the files listed by earlier polls and is updated with the current listing.
+func pollFiles(bucketUuid string, sessionUuid string, fileUuids []string, seen map[string]bool) ([]FileInfo, []FailedFile, error) {
+	if sessionUuid != "" {
+		return pollSession(bucketUuid, sessionUuid, seen)
+	}
+
+	var files []FileInfo
+	var failed []FailedFile
+	for _, fileUuid := range fileUuids {
+		details, err := GetFileDetails(bucketUuid, fileUuid)
+		if err != nil {
+			return nil, nil, err
+		}
+		if details.Status >= 400 {
+			failed = append(failed, FailedFile{FileUUID: fileUuid, Reason: fmt.Sprintf("file details returned status %d", details.Status)})
+			continue
+		}
+		files = append(files, details.Data)
+	}
+	return files, failed, nil
+}
+
+// pollSession lists every page of the files of a session. Files listed by an earlier poll
+// that are no longer listed are reported as failed.
+func pollSession(bucketUuid string, sessionUuid string, seen map[string]bool) ([]FileInfo, []FailedFile, error) {
+	opts := ListFilesOptions{Page: 1, Limit: DefaultListPageSize}
+	var files []FileInfo
+	for {
+		resp, err := ListSessionFilesWithOptions(bucketUuid, sessionUuid, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.Status >= 400 {
+			return nil, nil, fmt.Errorf("listing files of session %s returned status %d", sessionUuid, resp.Status)
+		}
+		files = append(files, resp.Data.Items...)
+		if len(resp.Data.Items) < opts.Limit || opts.Page*opts.Limit >= resp.Data.Total {
+			break
+		}
+		opts.Page++
+	}
+
+	listed := make(map[string]bool, len(files))
+	for _, f := range files {
+		listed[f.FileUUID] = true
+	}
+	var failed []FailedFile
+	for fileUuid := range seen {
+		if !listed[fileUuid] {
+			failed = append(failed, FailedFile{FileUUID: fileUuid, Reason: "file is no longer listed in session " + sessionUuid})
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].FileUUID < failed[j].FileUUID })
+	for fileUuid := range listed {
+		seen[fileUuid] = true
+	}
+	return files, failed, nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+var fastWait = WaitOptions{Timeout: time.Second, InitialInterval: time.Millisecond, MaxInterval: 5 * time.Millisecond}
+
+func TestWaitForFiles_PollsUntilPinned(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	path := "/storage/buckets/" + bucketUUID + "/files/file-1"
+
+	gock.New("https://api.apillon.io").Get(path).Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"fileUuid": "file-1", "fileStatus": 2}})
+	gock.New("https://api.apillon.io").Get(path).Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"fileUuid": "file-1", "fileStatus": 4, "CID": "QmTest"}})
+
+	files, err := WaitForFiles(bucketUUID, "", []string{"file-1"}, fastWait)
+	if err != nil {
+		t.Fatalf("WaitForFiles returned error: %v", err)
+	}
+	if len(files) != 1 || files[0].CID != "QmTest" {
+		t.Errorf("unexpected files: %+v", files)
+	}
+}
+
+func TestWaitForFiles_Session(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/" + bucketUUID + "/upload/session-1/files").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{
+			"total": 2,
+			"items": []map[string]any{
+				{"fileUuid": "file-1", "fileStatus": 4, "CID": "QmOne"},
+				{"fileUuid": "file-2", "fileStatus": 4, "CID": "QmTwo"},
+			},
+		}})
+
+	files, err := WaitForFiles(bucketUUID, "session-1", nil, fastWait)
+	if err != nil {
+		t.Fatalf("WaitForFiles returned error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("expected 2 files, got %+v", files)
+	}
+}
+
+func TestWaitForFiles_FailedAndTimeout(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	gock.New("https://api.apillon.io").Get("/storage/buckets/" + bucketUUID + "/files/missing").
+		Persist().Reply(404).
+		JSON(map[string]any{"status": 404, "message": "FILE_NOT_FOUND"})
+	gock.New("https://api.apillon.io").Get("/storage/buckets/" + bucketUUID + "/files/slow").
+		Persist().Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"fileUuid": "slow", "fileStatus": 2}})
+
+	opts := WaitOptions{Timeout: 20 * time.Millisecond, InitialInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+	_, err := WaitForFiles(bucketUUID, "", []string{"missing", "slow"}, opts)
+
+	var waitErr *WaitError
+	if !errors.As(err, &waitErr) {
+		t.Fatalf("expected *WaitError, got %v", err)
+	}
+	if !waitErr.TimedOut || len(waitErr.Pending) != 1 || waitErr.Pending[0].FileUUID != "slow" {
+		t.Errorf("unexpected pending files: %+v", waitErr)
+	}
+	if len(waitErr.Failed) != 1 || waitErr.Failed[0].FileUUID != "missing" {
+		t.Errorf("unexpected failed files: %+v", waitErr.Failed)
+	}
+}
+
+func TestWaitForFiles_SessionPagesAndDisappearingFiles(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	page := func(n int, total int, items ...map[string]any) {
+		gock.New("https://api.apillon.io").
+			Get("/storage/buckets/"+bucketUUID+"/upload/session-1/files").
+			MatchParam("page", "^"+strconv.Itoa(n)+"$").
+			Reply(200).
+			JSON(map[string]any{"status": 200, "data": map[string]any{"total": total, "items": items}})
+	}
+	fullPage := make([]map[string]any, DefaultListPageSize)
+	for i := range fullPage {
+		fullPage[i] = map[string]any{"fileUuid": "file-" + strconv.Itoa(i), "fileStatus": 4, "CID": "QmDone"}
+	}
+	// First poll: the last file is on the second page and still processing
+	page(1, DefaultListPageSize+1, fullPage...)
+	page(2, DefaultListPageSize+1, map[string]any{"fileUuid": "file-last", "fileStatus": 2})
+	// Second poll: the last file is pinned but another file disappeared
+	page(1, DefaultListPageSize, append(fullPage[1:], map[string]any{"fileUuid": "file-last", "fileStatus": 4, "CID": "QmLast"})...)
+
+	_, err := WaitForFiles(bucketUUID, "session-1", nil, fastWait)
+	var waitErr *WaitError
+	if !errors.As(err, &waitErr) {
+		t.Fatalf("expected *WaitError, got %v", err)
+	}
+	if waitErr.TimedOut || len(waitErr.Failed) != 1 || waitErr.Failed[0].FileUUID != "file-0" {
+		t.Errorf("unexpected wait error: %+v", waitErr)
+	}
+	if !gock.IsDone() {
+		t.Error("expected every page to be polled")
+	}
+}
+
+func TestWaitForFiles_PollsAtDeadline(t *testing.T) {
+	defer gock.Off()
+
+	bucketUUID := "test-bucket-uuid"
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/" + bucketUUID + "/files/file-1").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"fileUuid": "file-1", "fileStatus": 2}})
+	gock.New("https://api.apillon.io").
+		Get("/storage/buckets/" + bucketUUID + "/files/file-1").
+		Reply(200).
+		JSON(map[string]any{"status": 200, "data": map[string]any{"fileUuid": "file-1", "fileStatus": 4, "CID": "QmTest"}})
+
+	// The backoff interval is longer than the timeout, so the second poll must happen at the deadline
+	opts := WaitOptions{Timeout: 20 * time.Millisecond, InitialInterval: time.Hour, MaxInterval: time.Hour}
+	if _, err := WaitForFiles(bucketUUID, "", []string{"file-1"}, opts); err != nil {
+		t.Fatalf("WaitForFiles returned error: %v", err)
+	}
+}